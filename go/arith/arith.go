@@ -1,46 +1,131 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 var (
 	smallStep = flag.Bool("small-step", false, "run small-step evaluator")
 	bigStep   = flag.Bool("big-step", false, "run small-step evaluator")
+	wrong     = flag.Bool("wrong", false, "run small-step evaluator with explicit wrong (TAPL exercise 3.5.16)")
+	vm        = flag.Bool("vm", false, "compile to bytecode and run it on a stack machine")
+	disasm    = flag.Bool("disasm", false, "print the bytecode run by the stack machine")
+	graph     = flag.Bool("graph", false, "print the graph of all reductions in Graphviz DOT format")
+	deriv     = flag.String("derivation", "", "print the big-step derivation as \"text\" or \"latex\"")
+	check     = flag.Int("check", 0, "check the metatheory on every term up to the given depth")
+	cmpWrong  = flag.Bool("compare-wrong", false, "check that the term is stuck exactly when it evaluates to wrong")
+	numeric   = flag.Bool("numeric", false, "print numeric values as decimal numerals")
+	trace     = flag.Bool("trace", false, "print each step taken by the small-step evaluator")
+	strict    = flag.Bool("strict", false, "report stuck terms as errors")
+	typecheck = flag.Bool("typecheck", false, "type check before evaluating, or print the type if no evaluator is given")
 )
 
 func usage() {
-	fmt.Fprint(os.Stderr, "usage: arith ( -small-step | -big-step ) file\n\n")
+	fmt.Fprint(os.Stderr, "usage: arith [ -typecheck ] [ -strict ] [ -numeric ] ( -small-step [ -trace ] | -big-step | -wrong | -vm [ -disasm ] ) file\n")
+	fmt.Fprint(os.Stderr, "       arith -typecheck file\n")
+	fmt.Fprint(os.Stderr, "       arith -derivation ( text | latex ) file\n")
+	fmt.Fprint(os.Stderr, "       arith -compare-wrong file\n")
+	fmt.Fprint(os.Stderr, "       arith -graph file\n")
+	fmt.Fprint(os.Stderr, "       arith -check depth\n\n")
 	fmt.Fprint(os.Stderr, "arith is an implementation of the untyped calculus\n")
 	fmt.Fprint(os.Stderr, "of booleans and numbers (TAPL chapter 3 & 4).\n")
 	os.Exit(2)
 }
 
 func errExit(err error) {
+	if e, ok := err.(located); ok {
+		line, col := e.at().position()
+		err = fmt.Errorf("%s:%d:%d: %v\n%s", source.name, line, col, err, e.at().excerpt())
+	}
 	fmt.Fprintln(os.Stderr, err)
 	os.Exit(1)
 }
 
-type token uint8
+// source is the file being interpreted.
+var source struct {
+	name, text string
+}
+
+// span is a range of byte offsets into source.text.
+type span struct {
+	start, end int
+}
+
+func (s span) position() (line, col int) {
+	before := source.text[:s.start]
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	return strings.Count(before, "\n") + 1, utf8.RuneCountInString(before[lineStart:]) + 1
+}
+
+// excerpt returns the source line containing s, followed by a line that
+// underlines s with a caret.
+func (s span) excerpt() string {
+	lineStart := strings.LastIndexByte(source.text[:s.start], '\n') + 1
+	lineEnd := strings.IndexByte(source.text[s.start:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(source.text)
+	} else {
+		lineEnd += s.start
+	}
+	buf := new(strings.Builder)
+	fmt.Fprintln(buf, source.text[lineStart:lineEnd])
+	for _, r := range source.text[lineStart:s.start] {
+		if r == '\t' {
+			buf.WriteRune(r)
+		} else {
+			buf.WriteRune(' ')
+		}
+	}
+	buf.WriteString("^")
+	if end := s.end; end > s.start {
+		if end > lineEnd {
+			end = lineEnd
+		}
+		buf.WriteString(strings.Repeat("~", utf8.RuneCountInString(source.text[s.start:end])-1))
+	}
+	return buf.String()
+}
+
+// located is implemented by errors that refer to a span of the source.
+type located interface {
+	error
+	at() span
+}
+
+type syntaxError struct {
+	span span
+	msg  string
+}
+
+func (e syntaxError) Error() string { return e.msg }
+func (e syntaxError) at() span      { return e.span }
+
+type tokenType uint8
 
 const (
-	tEOF token = iota
+	tEOF tokenType = iota
 	tTrue
 	tFalse
 	tIf
 	tThen
 	tElse
-	tZero
+	tNat
 	tSucc
 	tPred
 	tIsZero
+	tPrim
+	tLParen
+	tRParen
+	tSemi
 )
 
-func (t token) String() string {
+func (t tokenType) String() string {
 	switch t {
 	case tEOF:
 		return "EOF"
@@ -54,47 +139,104 @@ func (t token) String() string {
 		return "then"
 	case tElse:
 		return "else"
-	case tZero:
-		return "0"
+	case tNat:
+		return "numeral"
 	case tSucc:
 		return "succ"
 	case tPred:
 		return "pred"
 	case tIsZero:
 		return "iszero"
+	case tPrim:
+		return "operator"
+	case tLParen:
+		return "("
+	case tRParen:
+		return ")"
+	case tSemi:
+		return ";"
 	}
 	panic("unreachable")
 }
 
-func scan(tokens chan<- token, input *bufio.Scanner) {
-	input.Split(bufio.ScanWords)
-	for input.Scan() {
-		switch word := input.Text(); word {
-		case "true":
-			tokens <- tTrue
-		case "false":
-			tokens <- tFalse
-		case "if":
-			tokens <- tIf
-		case "then":
-			tokens <- tThen
-		case "else":
-			tokens <- tElse
-		case "0":
-			tokens <- tZero
-		case "succ":
-			tokens <- tSucc
-		case "pred":
-			tokens <- tPred
-		case "iszero":
-			tokens <- tIsZero
+type token struct {
+	tokenType
+	span span
+}
+
+func (t token) String() string {
+	if t.tokenType == tNat || t.tokenType == tPrim {
+		return source.text[t.span.start:t.span.end]
+	}
+	return t.tokenType.String()
+}
+
+func isNumeral(word string) bool {
+	return strings.Trim(word, "0123456789") == ""
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func scan(tokens chan<- token, src string) {
+	for i := 0; i < len(src); {
+		r, n := utf8.DecodeRuneInString(src[i:])
+		emit := func(t tokenType) {
+			tokens <- token{t, span{i, i + n}}
+		}
+		switch {
+		case unicode.IsSpace(r):
+		case r == '(':
+			emit(tLParen)
+		case r == ')':
+			emit(tRParen)
+		case r == ';':
+			emit(tSemi)
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				errExit(syntaxError{span{i, i + 2}, "unterminated comment"})
+			}
+			n = end + 4
+		case isWordRune(r):
+			n = strings.IndexFunc(src[i:], func(r rune) bool { return !isWordRune(r) })
+			if n < 0 {
+				n = len(src) - i
+			}
+			switch word := src[i : i+n]; word {
+			case "true":
+				emit(tTrue)
+			case "false":
+				emit(tFalse)
+			case "if":
+				emit(tIf)
+			case "then":
+				emit(tThen)
+			case "else":
+				emit(tElse)
+			case "succ":
+				emit(tSucc)
+			case "pred":
+				emit(tPred)
+			case "iszero":
+				emit(tIsZero)
+			default:
+				if _, ok := lookupPrim(word); ok {
+					emit(tPrim)
+					break
+				}
+				if !isNumeral(word) {
+					errExit(syntaxError{span{i, i + n}, fmt.Sprintf("unexpected token %q", word)})
+				}
+				emit(tNat)
+			}
 		default:
-			errExit(fmt.Errorf("unexpected token %q", word))
+			errExit(syntaxError{span{i, i + n}, fmt.Sprintf("unexpected token %q", string(r))})
 		}
+		i += n
 	}
-	if err := input.Err(); err != nil {
-		errExit(err)
-	}
+	tokens <- token{tEOF, span{len(src), len(src)}}
 	close(tokens)
 }
 
@@ -108,6 +250,8 @@ const (
 	tmPred
 	tmIsZero
 	tmIf
+	tmWrong
+	tmPrim // the first primitive operator; see prims
 )
 
 func (t tmType) String() string {
@@ -126,6 +270,11 @@ func (t tmType) String() string {
 		return "iszero"
 	case tmIf:
 		return "if"
+	case tmWrong:
+		return "wrong"
+	}
+	if p, ok := t.prim(); ok {
+		return p.name
 	}
 	panic("unreachable")
 }
@@ -139,67 +288,164 @@ type term struct {
 	// tmPred   t1
 	// tmIsZero t1
 	// tmIf     t1 t2 t3
+	// tmWrong
+	// tmPrim+i t1 ... tn
 	children []term
+	span     span
+}
+
+// node returns the label and children that t is printed with.
+func (t term) node() (string, []term) {
+	if *numeric && isNumericVal(t) {
+		return strconv.Itoa(natValue(t)), nil
+	}
+	return t.tmType.String(), t.children
 }
 
 func printChildren(buf *strings.Builder, indent string, children []term) {
 	for i, t := range children {
+		label, tChildren := t.node()
 		switch i {
 		case len(children) - 1:
-			fmt.Fprintf(buf, "%s└─%s\n", indent, t.tmType)
-			printChildren(buf, indent+"  ", t.children)
+			fmt.Fprintf(buf, "%s└─%s\n", indent, label)
+			printChildren(buf, indent+"  ", tChildren)
 		default:
-			fmt.Fprintf(buf, "%s├─%s\n", indent, t.tmType)
-			printChildren(buf, indent+"│ ", t.children)
+			fmt.Fprintf(buf, "%s├─%s\n", indent, label)
+			printChildren(buf, indent+"│ ", tChildren)
 		}
 	}
 }
 
 func (t term) String() string {
 	buf := new(strings.Builder)
-	fmt.Fprintln(buf, t.tmType)
-	printChildren(buf, "", t.children)
+	label, children := t.node()
+	fmt.Fprintln(buf, label)
+	printChildren(buf, "", children)
 	return buf.String()
 }
 
-func expect(tokens <-chan token, want token) {
-	if got := <-tokens; got != want {
-		errExit(fmt.Errorf("expected token %q, got %q", want, got))
+func (t term) equal(u term) bool {
+	if t.tmType != u.tmType || len(t.children) != len(u.children) {
+		return false
+	}
+	for i := range t.children {
+		if !t.children[i].equal(u.children[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// syntax renders t on a single line in the concrete syntax accepted by parse.
+func (t term) syntax() string {
+	if *numeric && isNumericVal(t) {
+		return strconv.Itoa(natValue(t))
+	}
+	if t.tmType == tmIf {
+		return "if " + t.children[0].syntax() + " then " + t.children[1].syntax() + " else " + t.children[2].syntax()
+	}
+	parts := []string{t.tmType.String()}
+	for _, c := range t.children {
+		parts = append(parts, c.syntax())
+	}
+	return strings.Join(parts, " ")
+}
+
+func expect(tokens <-chan token, want tokenType) token {
+	got := <-tokens
+	if got.tokenType != want {
+		errExit(syntaxError{got.span, fmt.Sprintf("expected token %q, got %q", want, got)})
 	}
+	return got
 }
 
 func parse(tokens <-chan token) term {
-	var tok token
-L:
-	for tok = range tokens {
-		switch tok {
-		case tTrue:
-			return term{tmType: tmTrue}
-		case tFalse:
-			return term{tmType: tmFalse}
-		case tZero:
-			return term{tmType: tmZero}
-		case tSucc:
-			return term{tmType: tmSucc, children: []term{parse(tokens)}}
-		case tPred:
-			return term{tmType: tmPred, children: []term{parse(tokens)}}
-		case tIsZero:
-			return term{tmType: tmIsZero, children: []term{parse(tokens)}}
-		case tIf:
-			t1 := parse(tokens)
-			expect(tokens, tThen)
-			t2 := parse(tokens)
-			expect(tokens, tElse)
-			t3 := parse(tokens)
-			return term{tmType: tmIf, children: []term{t1, t2, t3}}
-		default:
-			break L
+	return parseTerm(<-tokens, tokens)
+}
+
+// maxNumeral is the largest numeral accepted in source. Numerals are
+// expanded into nested succ terms, which the evaluators walk recursively.
+const maxNumeral = 1 << 16
+
+// parseNumeral returns the value of the numeral s, if it is at most
+// maxNumeral.
+func parseNumeral(s string) (int, bool) {
+	n, err := strconv.Atoi(s)
+	return n, err == nil && n <= maxNumeral
+}
+
+// parseTerm parses a term whose first token tok has already been read.
+func parseTerm(tok token, tokens <-chan token) term {
+	unary := func(tmType tmType) term {
+		t1 := parse(tokens)
+		return term{tmType: tmType, children: []term{t1}, span: span{tok.span.start, t1.span.end}}
+	}
+	switch tok.tokenType {
+	case tTrue:
+		return term{tmType: tmTrue, span: tok.span}
+	case tFalse:
+		return term{tmType: tmFalse, span: tok.span}
+	case tNat:
+		n, ok := parseNumeral(tok.String())
+		if !ok {
+			errExit(syntaxError{tok.span, fmt.Sprintf("numeral %s out of range", tok)})
 		}
+		t := term{tmType: tmZero, span: tok.span}
+		for ; n > 0; n-- {
+			t = term{tmType: tmSucc, children: []term{t}, span: tok.span}
+		}
+		return t
+	case tSucc:
+		return unary(tmSucc)
+	case tPred:
+		return unary(tmPred)
+	case tIsZero:
+		return unary(tmIsZero)
+	case tIf:
+		t1 := parse(tokens)
+		expect(tokens, tThen)
+		t2 := parse(tokens)
+		expect(tokens, tElse)
+		t3 := parse(tokens)
+		return term{tmType: tmIf, children: []term{t1, t2, t3}, span: span{tok.span.start, t3.span.end}}
+	case tPrim:
+		tmType, _ := lookupPrim(tok.String())
+		p, _ := tmType.prim()
+		t := term{tmType: tmType, span: tok.span}
+		for range p.params {
+			ti := parse(tokens)
+			t.children = append(t.children, ti)
+			t.span.end = ti.span.end
+		}
+		return t
+	case tLParen:
+		t := parse(tokens)
+		expect(tokens, tRParen)
+		return t
 	}
-	errExit(fmt.Errorf("unexpected token %q", tok))
+	errExit(syntaxError{tok.span, fmt.Sprintf("unexpected token %q", tok)})
 	panic("unreachable")
 }
 
+// parseFile parses one or more terms separated by semicolons. The semicolon
+// after the last term is optional.
+func parseFile(tokens <-chan token) []term {
+	terms := []term{parse(tokens)}
+	for {
+		switch tok := <-tokens; tok.tokenType {
+		case tEOF:
+			return terms
+		case tSemi:
+			if tok = <-tokens; tok.tokenType == tEOF {
+				return terms
+			}
+			terms = append(terms, parseTerm(tok, tokens))
+		default:
+			errExit(syntaxError{tok.span, fmt.Sprintf("expected token %q, got %q", tEOF, tok)})
+		}
+	}
+}
+
 func isNumericVal(t term) bool {
 	switch t.tmType {
 	case tmZero:
@@ -211,6 +457,15 @@ func isNumericVal(t term) bool {
 	}
 }
 
+// natValue returns the number represented by the numeric value t.
+func natValue(t term) int {
+	n := 0
+	for ; t.tmType == tmSucc; t = t.children[0] {
+		n++
+	}
+	return n
+}
+
 func isVal(t term) bool {
 	switch t.tmType {
 	case tmTrue, tmFalse:
@@ -222,55 +477,91 @@ func isVal(t term) bool {
 
 var noRuleApplies = fmt.Errorf("no rule applies")
 
-func eval1(t term) (res term, err error) {
+// step records how eval1 rewrote a term: the congruence rules leading to the
+// redex, followed by the computation rule that contracted it.
+type step struct {
+	rules      []string
+	redex      term
+	contractum term
+}
+
+func (s step) String() string {
+	return strings.Join(s.rules, " > ") + ": " + s.redex.syntax() + " → " + s.contractum.syntax()
+}
+
+func eval1(t term) (term, error) {
+	res, _, err := eval1Step(t)
+	return res, err
+}
+
+func eval1Step(t term) (res term, s step, err error) {
+	axiom := func(rule string, res term) (term, step, error) {
+		return res, step{[]string{rule}, t, res}, nil
+	}
+	congruence := func(rule string, t1 term, rebuild func(t1Prime term) term) (term, step, error) {
+		t1Prime, s, err := eval1Step(t1)
+		if err != nil {
+			return res, s, err
+		}
+		s.rules = append([]string{rule}, s.rules...)
+		res := rebuild(t1Prime)
+		res.span = t.span
+		return res, s, nil
+	}
 	switch t.tmType {
 	case tmIf:
 		switch t1 := t.children[0]; t1.tmType {
 		case tmTrue:
-			return t.children[1], nil
+			return axiom("E-IfTrue", t.children[1])
 		case tmFalse:
-			return t.children[2], nil
+			return axiom("E-IfFalse", t.children[2])
 		default:
-			t1Prime, err := eval1(t1)
-			if err != nil {
-				return res, err
-			}
-			return term{tmType: tmIf, children: []term{t1Prime, t.children[1], t.children[2]}}, nil
+			return congruence("E-If", t1, func(t1Prime term) term {
+				return term{tmType: tmIf, children: []term{t1Prime, t.children[1], t.children[2]}}
+			})
 		}
 	case tmSucc:
-		t1Prime, err := eval1(t.children[0])
-		if err != nil {
-			return res, err
-		}
-		return term{tmType: tmSucc, children: []term{t1Prime}}, nil
+		return congruence("E-Succ", t.children[0], func(t1Prime term) term {
+			return term{tmType: tmSucc, children: []term{t1Prime}}
+		})
 	case tmPred:
 		switch t1 := t.children[0]; {
 		case t1.tmType == tmZero:
-			return term{tmType: tmZero}, nil
+			return axiom("E-PredZero", term{tmType: tmZero})
 		case t1.tmType == tmSucc && isNumericVal(t1.children[0]):
-			return t1.children[0], nil
+			return axiom("E-PredSucc", t1.children[0])
 		default:
-			t1Prime, err := eval1(t1)
-			if err != nil {
-				return res, err
-			}
-			return term{tmType: tmPred, children: []term{t1Prime}}, nil
+			return congruence("E-Pred", t1, func(t1Prime term) term {
+				return term{tmType: tmPred, children: []term{t1Prime}}
+			})
 		}
 	case tmIsZero:
 		switch t1 := t.children[0]; {
 		case t1.tmType == tmZero:
-			return term{tmType: tmTrue}, nil
+			return axiom("E-IsZeroZero", term{tmType: tmTrue})
 		case t1.tmType == tmSucc && isNumericVal(t1.children[0]):
-			return term{tmType: tmFalse}, nil
+			return axiom("E-IsZeroSucc", term{tmType: tmFalse})
 		default:
-			t1Prime, err := eval1(t1)
-			if err != nil {
-				return res, err
+			return congruence("E-IsZero", t1, func(t1Prime term) term {
+				return term{tmType: tmIsZero, children: []term{t1Prime}}
+			})
+		}
+	}
+	if p, ok := t.tmType.prim(); ok {
+		for i, ti := range t.children {
+			if !isVal(ti) {
+				return congruence(fmt.Sprintf("E-%s%d", p.ruleName(), i+1), ti, func(tiPrime term) term {
+					children := append([]term(nil), t.children...)
+					children[i] = tiPrime
+					return term{tmType: t.tmType, children: children}
+				})
 			}
-			return term{tmType: tmIsZero, children: []term{t1Prime}}, nil
+		}
+		if rule, res, ok := p.step(t.children); ok {
+			return axiom(rule, res)
 		}
 	}
-	return res, noRuleApplies
+	return res, s, noRuleApplies
 }
 
 func evalSmallStep(t term) term {
@@ -281,11 +572,81 @@ func evalSmallStep(t term) term {
 	return evalSmallStep(t1Prime)
 }
 
-func evalBigStep(t term) term {
-	if isVal(t) || t.tmType <= tmZero {
+// traceSmallStep is evalSmallStep, but prints each intermediate term along
+// with the step that rewrote it.
+func traceSmallStep(t term) term {
+	fmt.Println(t.syntax())
+	t1Prime, s, err := eval1Step(t)
+	if err != nil {
 		return t
 	}
-	switch v1 := evalBigStep(t.children[0]); t.tmType {
+	fmt.Println("  " + s.String())
+	return traceSmallStep(t1Prime)
+}
+
+// stuckError reports the innermost subterm of a stuck term to which no
+// evaluation rule applies.
+type stuckError struct {
+	t term
+}
+
+func (e stuckError) Error() string {
+	return fmt.Sprintf("no rule applies to %q", e.t.syntax())
+}
+
+func (e stuckError) at() span {
+	return e.t.span
+}
+
+// evalPositions returns the subterms of t that are evaluated before t itself
+// is contracted, in order.
+func evalPositions(t term) []term {
+	if t.tmType == tmIf {
+		return t.children[:1]
+	}
+	return t.children
+}
+
+// stuck classifies a normal form of the small-step evaluator. It returns nil
+// for values and a stuckError for stuck terms.
+func stuck(t term) error {
+	if isVal(t) {
+		return nil
+	}
+	for _, ti := range evalPositions(t) {
+		if !isVal(ti) {
+			return stuck(ti)
+		}
+	}
+	return stuckError{t}
+}
+
+// evalBigStep evaluates t to a value. If no rule applies, it returns the term
+// it stopped on together with a stuckError, so that stuck terms are classified
+// the same way as by stuck.
+func evalBigStep(t term) (term, error) {
+	if isVal(t) || t.tmType <= tmZero {
+		return t, nil
+	}
+	if p, ok := t.tmType.prim(); ok {
+		vs := make([]term, len(t.children))
+		for i, ti := range t.children {
+			vi, err := evalBigStep(ti)
+			if err != nil {
+				return t, err
+			}
+			vs[i] = vi
+		}
+		if v, ok := p.eval(vs); ok {
+			return v, nil
+		}
+		return t, stuckError{term{tmType: t.tmType, children: vs, span: t.span}}
+	}
+	v1, err := evalBigStep(t.children[0])
+	if err != nil {
+		return t, err
+	}
+	switch t.tmType {
 	case tmIf:
 		switch v1.tmType {
 		case tmTrue:
@@ -295,49 +656,225 @@ func evalBigStep(t term) term {
 		}
 	case tmSucc:
 		if isNumericVal(v1) {
-			return term{tmType: tmSucc, children: []term{v1}}
+			return term{tmType: tmSucc, children: []term{v1}}, nil
 		}
 	case tmPred:
 		switch v1.tmType {
 		case tmZero:
-			return v1
+			return v1, nil
 		case tmSucc:
-			return v1.children[0]
+			return v1.children[0], nil
 		}
 	case tmIsZero:
 		switch v1.tmType {
 		case tmZero:
-			return term{tmType: tmTrue}
+			return term{tmType: tmTrue}, nil
 		case tmSucc:
-			return term{tmType: tmFalse}
+			return term{tmType: tmFalse}, nil
 		}
 	}
-	return t
+	children := append([]term{v1}, t.children[1:]...)
+	return t, stuckError{term{tmType: t.tmType, children: children, span: t.span}}
+}
+
+type ty uint8
+
+const (
+	tyBool ty = iota
+	tyNat
+)
+
+func (t ty) String() string {
+	switch t {
+	case tyBool:
+		return "Bool"
+	case tyNat:
+		return "Nat"
+	}
+	panic("unreachable")
+}
+
+// typeError reports a subterm whose type does not match the one required
+// by the typing rule that was being applied.
+type typeError struct {
+	what string
+	t    term
+	want ty
+	got  ty
+}
+
+func (e typeError) Error() string {
+	return fmt.Sprintf("%s %q has type %s, expected %s", e.what, e.t.syntax(), e.got, e.want)
+}
+
+func (e typeError) at() span {
+	return e.t.span
+}
+
+func expectType(what string, t term, want ty) error {
+	got, err := typeOf(t)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return typeError{what, t, want, got}
+	}
+	return nil
+}
+
+// typeOf assigns a type to t using the rules of the typed calculus of
+// booleans and numbers (TAPL chapter 8).
+func typeOf(t term) (ty, error) {
+	switch t.tmType {
+	case tmTrue, tmFalse:
+		return tyBool, nil
+	case tmZero:
+		return tyNat, nil
+	case tmSucc, tmPred:
+		if err := expectType("argument of "+t.tmType.String(), t.children[0], tyNat); err != nil {
+			return 0, err
+		}
+		return tyNat, nil
+	case tmIsZero:
+		if err := expectType("argument of iszero", t.children[0], tyNat); err != nil {
+			return 0, err
+		}
+		return tyBool, nil
+	case tmIf:
+		if err := expectType("guard of conditional", t.children[0], tyBool); err != nil {
+			return 0, err
+		}
+		tyT2, err := typeOf(t.children[1])
+		if err != nil {
+			return 0, err
+		}
+		if err := expectType("else branch", t.children[2], tyT2); err != nil {
+			return 0, err
+		}
+		return tyT2, nil
+	}
+	if p, ok := t.tmType.prim(); ok {
+		for i, ti := range t.children {
+			if err := expectType(fmt.Sprintf("argument %d of %s", i+1, p.name), ti, p.params[i]); err != nil {
+				return 0, err
+			}
+		}
+		return p.result, nil
+	}
+	panic("unreachable")
 }
 
 func main() {
 	flag.Usage = usage
 	flag.Parse()
-	if *smallStep == *bigStep {
+	evaluators := 0
+	for _, b := range []bool{*smallStep, *bigStep, *wrong, *vm, *cmpWrong, *graph, *deriv != ""} {
+		if b {
+			evaluators++
+		}
+	}
+	switch *deriv {
+	case "", "text", "latex":
+	default:
+		usage()
+	}
+	if evaluators > 1 || evaluators == 0 && !*typecheck && *check == 0 || *trace && !*smallStep || *disasm && !*vm {
 		usage()
 	}
 	args := flag.Args()
+	if *check > 0 {
+		if evaluators > 0 || *typecheck || len(args) != 0 {
+			usage()
+		}
+		if !checkAll(*check) {
+			os.Exit(1)
+		}
+		return
+	}
 	if len(args) != 1 {
 		usage()
 	}
-	file, err := os.Open(args[0])
+	b, err := os.ReadFile(args[0])
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		usage()
 	}
-	defer file.Close()
-	tokens := make(chan token)
-	go scan(tokens, bufio.NewScanner(file))
-	ast := parse(tokens)
-	expect(tokens, tEOF)
-	if *smallStep {
-		fmt.Print(evalSmallStep(ast))
+	source.name, source.text = args[0], string(b)
+	// Printed results can be read back in, and are recognized by the
+	// structure of the tree format.
+	var terms []term
+	if isTree(source.text) {
+		terms, err = parseTree(source.text)
+		if err != nil {
+			errExit(err)
+		}
 	} else {
-		fmt.Print(evalBigStep(ast))
+		tokens := make(chan token)
+		go scan(tokens, source.text)
+		terms = parseFile(tokens)
+	}
+	for _, ast := range terms {
+		run(ast, evaluators == 0)
+	}
+}
+
+// run evaluates ast with the evaluator selected on the command line and
+// prints the result. If printType is set, it only prints the type of ast.
+func run(ast term, printType bool) {
+	if *typecheck {
+		tyT, err := typeOf(ast)
+		if err != nil {
+			errExit(err)
+		}
+		if printType {
+			fmt.Println(tyT)
+			return
+		}
+	}
+	switch {
+	case *cmpWrong:
+		if err := compareWrong(ast); err != nil {
+			errExit(err)
+		}
+	case *graph:
+		fmt.Print(reductionGraph(ast))
+	case *deriv != "":
+		d, err := derive(ast)
+		if err != nil {
+			errExit(err)
+		}
+		if *deriv == "latex" {
+			fmt.Print(d.LaTeX())
+		} else {
+			fmt.Print(d)
+		}
+	case *wrong:
+		fmt.Print(evalWrong(ast))
+	case *vm:
+		prog := compile(ast)
+		if *disasm {
+			fmt.Print(prog)
+		}
+		v, err := prog.run()
+		if *strict && err != nil {
+			errExit(err)
+		}
+		fmt.Print(v)
+	case *smallStep:
+		evalSmallStep := evalSmallStep
+		if *trace {
+			evalSmallStep = traceSmallStep
+		}
+		nf := evalSmallStep(ast)
+		if err := stuck(nf); *strict && err != nil {
+			errExit(err)
+		}
+		fmt.Print(nf)
+	default:
+		v, err := evalBigStep(ast)
+		if *strict && err != nil {
+			errExit(err)
+		}
+		fmt.Print(v)
 	}
 }
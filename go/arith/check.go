@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// This file implements an exhaustive check of the metatheory of TAPL chapter
+// 3 over every term up to a given depth. It serves as a regression oracle for
+// the evaluators.
+
+// checkSteps bounds the number of steps taken to evaluate a term.
+const checkSteps = 1000
+
+// enumerate returns every term of depth at most depth.
+func enumerate(depth int) []term {
+	if depth == 0 {
+		return nil
+	}
+	smaller := enumerate(depth - 1)
+	ts := []term{{tmType: tmTrue}, {tmType: tmFalse}, {tmType: tmZero}}
+	for _, op := range []tmType{tmSucc, tmPred, tmIsZero} {
+		for _, t1 := range smaller {
+			ts = append(ts, term{tmType: op, children: []term{t1}})
+		}
+	}
+	for _, t1 := range smaller {
+		for _, t2 := range smaller {
+			for _, t3 := range smaller {
+				ts = append(ts, term{tmType: tmIf, children: []term{t1, t2, t3}})
+			}
+		}
+	}
+	for i, p := range prims {
+		args := [][]term{nil}
+		for range p.params {
+			var longer [][]term
+			for _, prefix := range args {
+				for _, ti := range smaller {
+					longer = append(longer, append(prefix[:len(prefix):len(prefix)], ti))
+				}
+			}
+			args = longer
+		}
+		for _, children := range args {
+			ts = append(ts, term{tmType: tmPrim + tmType(i), children: children})
+		}
+	}
+	return ts
+}
+
+// consts, size and depth are defined as in TAPL definition 3.3.1 and 3.3.2.
+
+func consts(t term) map[tmType]bool {
+	if len(t.children) == 0 {
+		return map[tmType]bool{t.tmType: true}
+	}
+	res := make(map[tmType]bool)
+	for _, c := range t.children {
+		for k := range consts(c) {
+			res[k] = true
+		}
+	}
+	return res
+}
+
+func size(t term) int {
+	n := 1
+	for _, c := range t.children {
+		n += size(c)
+	}
+	return n
+}
+
+func depth(t term) int {
+	n := 0
+	for _, c := range t.children {
+		if d := depth(c); d > n {
+			n = d
+		}
+	}
+	return n + 1
+}
+
+func metrics(t term) string {
+	var names []string
+	for k := range consts(t) {
+		names = append(names, k.String())
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("size %d, depth %d, consts {%s}", size(t), depth(t), strings.Join(names, ", "))
+}
+
+// reduction is a single step of the evaluation relation from some term to
+// result.
+type reduction struct {
+	step
+	result term
+}
+
+// reductions returns every way a single rule of the evaluation relation
+// (TAPL figures 3-1 and 3-2) applies to t. Unlike eval1, each rule is tried
+// independently of the others, so determinacy can be checked against it. If
+// anywhere is set, the congruence rules apply to every subterm, which makes
+// the relation nondeterministic.
+func reductions(t term, anywhere bool) (res []reduction) {
+	axiom := func(rule string, result term) {
+		res = append(res, reduction{step{[]string{rule}, t, result}, result})
+	}
+	congruence := func(rule string, i int) {
+		for _, r := range reductions(t.children[i], anywhere) {
+			children := append([]term(nil), t.children...)
+			children[i] = r.result
+			r.rules = append([]string{rule}, r.rules...)
+			r.result = term{tmType: t.tmType, children: children}
+			res = append(res, r)
+		}
+	}
+	if len(t.children) == 0 {
+		return nil
+	}
+	if p, ok := t.tmType.prim(); ok {
+		for i, ti := range t.children {
+			congruence(fmt.Sprintf("E-%s%d", p.ruleName(), i+1), i)
+			if !isVal(ti) && !anywhere {
+				break
+			}
+		}
+		if rule, result, ok := p.step(t.children); ok {
+			axiom(rule, result)
+		}
+		return res
+	}
+	t1 := t.children[0]
+	switch t.tmType {
+	case tmIf:
+		if t1.tmType == tmTrue {
+			axiom("E-IfTrue", t.children[1])
+		}
+		if t1.tmType == tmFalse {
+			axiom("E-IfFalse", t.children[2])
+		}
+		congruence("E-If", 0)
+		if anywhere {
+			congruence("E-IfThen", 1)
+			congruence("E-IfElse", 2)
+		}
+	case tmSucc:
+		congruence("E-Succ", 0)
+	case tmPred:
+		if t1.tmType == tmZero {
+			axiom("E-PredZero", term{tmType: tmZero})
+		}
+		if t1.tmType == tmSucc && isNumericVal(t1.children[0]) {
+			axiom("E-PredSucc", t1.children[0])
+		}
+		congruence("E-Pred", 0)
+	case tmIsZero:
+		if t1.tmType == tmZero {
+			axiom("E-IsZeroZero", term{tmType: tmTrue})
+		}
+		if t1.tmType == tmSucc && isNumericVal(t1.children[0]) {
+			axiom("E-IsZeroSucc", term{tmType: tmFalse})
+		}
+		congruence("E-IsZero", 0)
+	}
+	return res
+}
+
+// checkTerm returns a description of every property that fails for t.
+func checkTerm(t term) (failures []string) {
+	fail := func(format string, args ...any) {
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+
+	// Theorem 3.5.4: determinacy of one-step evaluation.
+	rs := reductions(t, false)
+	t1Prime, err := eval1(t)
+	switch {
+	case len(rs) > 1:
+		var steps []string
+		for _, r := range rs {
+			steps = append(steps, r.step.String())
+		}
+		fail("more than one rule applies: %s", strings.Join(steps, "; "))
+	case len(rs) == 1 && (err != nil || !t1Prime.equal(rs[0].result)):
+		fail("eval1 does not take the step %s", rs[0].step)
+	case len(rs) == 0 && err == nil:
+		fail("eval1 steps to %q, but no rule applies", t1Prime.syntax())
+	}
+
+	// Theorem 3.5.12: termination of evaluation. The rules of primitive
+	// operators do not always decrease the size of a term, so the number of
+	// steps is bounded by a generous budget instead.
+	nf, n := t, 0
+	for ; n <= checkSteps; n++ {
+		next, err := eval1(nf)
+		if err != nil {
+			break
+		}
+		nf = next
+	}
+	if n > checkSteps {
+		fail("evaluation did not terminate within %d steps", checkSteps)
+		return failures
+	}
+
+	// Theorem 3.5.11 and exercise 3.5.17: small-step and big-step evaluation
+	// agree on normal forms, and classify stuck terms the same way.
+	if !evalSmallStep(t).equal(nf) {
+		fail("evalSmallStep does not reach %q", nf.syntax())
+	}
+	v, bigErr := evalBigStep(t)
+	smallErr := stuck(nf)
+	switch {
+	case smallErr == nil && bigErr == nil && !v.equal(nf):
+		fail("evalSmallStep gives %q, evalBigStep gives %q", nf.syntax(), v.syntax())
+	case smallErr == nil && bigErr != nil:
+		fail("evalSmallStep gives %q, evalBigStep: %v", nf.syntax(), bigErr)
+	case smallErr != nil && bigErr == nil:
+		fail("evalSmallStep: %v, evalBigStep gives %q", smallErr, v.syntax())
+	case smallErr != nil && smallErr.(stuckError).t.syntax() != bigErr.(stuckError).t.syntax():
+		fail("evalSmallStep: %v, evalBigStep: %v", smallErr, bigErr)
+	}
+	if vmV, err := compile(t).run(); (err == nil) != (bigErr == nil) || !vmV.equal(v) {
+		fail("the stack machine gives %q (%v), evalBigStep gives %q (%v)", vmV.syntax(), err, v.syntax(), bigErr)
+	} else if err != nil && err.(stuckError).t.syntax() != bigErr.(stuckError).t.syntax() {
+		fail("the stack machine: %v, evalBigStep: %v", err, bigErr)
+	}
+	if d, err := derive(t); err == nil && (bigErr != nil || !d.v.equal(v)) {
+		fail("derivation concludes %q, evalBigStep gives %q", d.v.syntax(), v.syntax())
+	} else if (err == nil) != (bigErr == nil) {
+		fail("derive: %v, evalBigStep: %v", err, bigErr)
+	}
+
+	// Exercise 3.5.16: a term is stuck exactly when it evaluates to wrong.
+	if w := evalWrong(t); (smallErr != nil) != (w.tmType == tmWrong) || smallErr == nil && !w.equal(nf) {
+		fail("evalSmallStep gives %q, evalWrong gives %q", nf.syntax(), w.syntax())
+	}
+
+	// Theorems 8.3.2 and 8.3.3: well-typed terms do not get stuck, and their
+	// values have the same type.
+	if tyT, err := typeOf(t); err == nil {
+		if smallErr != nil {
+			fail("well-typed term of type %s gets stuck: %v", tyT, smallErr)
+		} else if tyV, _ := typeOf(nf); tyV != tyT {
+			fail("term of type %s evaluates to %q of type %s", tyT, nf.syntax(), tyV)
+		}
+	}
+
+	// The tree printed for t is recognized as such and parses back to t.
+	if !isTree(t.String()) {
+		fail("printed tree is not recognized as a tree")
+	}
+	if ts, err := parseTree(t.String()); err != nil {
+		fail("printed tree does not parse: %v", err)
+	} else if len(ts) != 1 || !ts[0].equal(t) {
+		fail("printed tree parses to %d terms, starting with %q", len(ts), ts[0].syntax())
+	}
+
+	// Lemma 3.3.3: the number of distinct constants is at most the size.
+	if len(consts(t)) > size(t) {
+		fail("%d constants but size %d", len(consts(t)), size(t))
+	}
+	return failures
+}
+
+// checkAll checks every term up to the given depth and prints each
+// counterexample. It reports whether all checks passed.
+func checkAll(maxDepth int) bool {
+	ts := enumerate(maxDepth)
+	counterexamples := 0
+	for _, t := range ts {
+		failures := checkTerm(t)
+		if len(failures) == 0 {
+			continue
+		}
+		counterexamples++
+		fmt.Printf("%s (%s)\n", t.syntax(), metrics(t))
+		for _, f := range failures {
+			fmt.Printf("  %s\n", f)
+		}
+	}
+	fmt.Printf("checked %d terms up to depth %d: %d counterexamples\n", len(ts), maxDepth, counterexamples)
+	return counterexamples == 0
+}
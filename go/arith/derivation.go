@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// derivation is a proof of the big-step evaluation judgment t ⇓ v, built from
+// the rules of TAPL exercise 3.5.17.
+type derivation struct {
+	rule     string
+	t, v     term
+	premises []derivation
+}
+
+func derive(t term) (d derivation, err error) {
+	if isVal(t) {
+		return derivation{"B-Value", t, t, nil}, nil
+	}
+	if p, ok := t.tmType.prim(); ok {
+		premises := make([]derivation, len(t.children))
+		vs := make([]term, len(t.children))
+		for i, ti := range t.children {
+			if premises[i], err = derive(ti); err != nil {
+				return d, err
+			}
+			vs[i] = premises[i].v
+		}
+		if v, ok := p.eval(vs); ok {
+			return derivation{"B-" + p.ruleName(), t, v, premises}, nil
+		}
+		return d, stuckError{term{tmType: t.tmType, children: vs, span: t.span}}
+	}
+	d1, err := derive(t.children[0])
+	if err != nil {
+		return d, err
+	}
+	switch v1 := d1.v; t.tmType {
+	case tmIf:
+		var rule string
+		var t2 term
+		switch v1.tmType {
+		case tmTrue:
+			rule, t2 = "B-IfTrue", t.children[1]
+		case tmFalse:
+			rule, t2 = "B-IfFalse", t.children[2]
+		}
+		if rule != "" {
+			d2, err := derive(t2)
+			if err != nil {
+				return d, err
+			}
+			return derivation{rule, t, d2.v, []derivation{d1, d2}}, nil
+		}
+	case tmSucc:
+		if isNumericVal(v1) {
+			return derivation{"B-Succ", t, term{tmType: tmSucc, children: []term{v1}}, []derivation{d1}}, nil
+		}
+	case tmPred:
+		switch v1.tmType {
+		case tmZero:
+			return derivation{"B-PredZero", t, v1, []derivation{d1}}, nil
+		case tmSucc:
+			return derivation{"B-PredSucc", t, v1.children[0], []derivation{d1}}, nil
+		}
+	case tmIsZero:
+		switch v1.tmType {
+		case tmZero:
+			return derivation{"B-IsZeroZero", t, term{tmType: tmTrue}, []derivation{d1}}, nil
+		case tmSucc:
+			return derivation{"B-IsZeroSucc", t, term{tmType: tmFalse}, []derivation{d1}}, nil
+		}
+	}
+	children := append([]term{d1.v}, t.children[1:]...)
+	return d, stuckError{term{tmType: t.tmType, children: children, span: t.span}}
+}
+
+func (d derivation) judgment() string {
+	return d.rule + ": " + d.t.syntax() + " ⇓ " + d.v.syntax()
+}
+
+func printPremises(buf *strings.Builder, indent string, premises []derivation) {
+	for i, d := range premises {
+		switch i {
+		case len(premises) - 1:
+			fmt.Fprintf(buf, "%s└─%s\n", indent, d.judgment())
+			printPremises(buf, indent+"  ", d.premises)
+		default:
+			fmt.Fprintf(buf, "%s├─%s\n", indent, d.judgment())
+			printPremises(buf, indent+"│ ", d.premises)
+		}
+	}
+}
+
+func (d derivation) String() string {
+	buf := new(strings.Builder)
+	fmt.Fprintln(buf, d.judgment())
+	printPremises(buf, "", d.premises)
+	return buf.String()
+}
+
+func (d derivation) writeLaTeX(buf *strings.Builder) {
+	for _, p := range d.premises {
+		p.writeLaTeX(buf)
+	}
+	if len(d.premises) == 0 {
+		fmt.Fprintln(buf, `\AxiomC{}`)
+	}
+	fmt.Fprintf(buf, "\\RightLabel{\\scriptsize %s}\n", d.rule)
+	inference := [...]string{"Unary", "Unary", "Binary", "Trinary", "Quaternary", "Quinary"}[len(d.premises)]
+	fmt.Fprintf(buf, "\\%sInfC{\\texttt{%s} $\\Downarrow$ \\texttt{%s}}\n", inference, d.t.syntax(), d.v.syntax())
+}
+
+// LaTeX renders d as a bussproofs prooftree environment.
+func (d derivation) LaTeX() string {
+	buf := new(strings.Builder)
+	fmt.Fprintln(buf, `\begin{prooftree}`)
+	d.writeLaTeX(buf)
+	fmt.Fprintln(buf, `\end{prooftree}`)
+	return buf.String()
+}
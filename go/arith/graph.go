@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// graphNodes bounds the number of terms explored by reductionGraph.
+const graphNodes = 1000
+
+// reductionGraph returns the graph of terms reachable from t when the
+// congruence rules may rewrite any subterm, in Graphviz DOT format. Edges
+// taken by eval1 are drawn solid, and the others dashed. Values are drawn
+// with a double border, and stuck terms in red.
+func reductionGraph(t term) string {
+	buf := new(strings.Builder)
+	fmt.Fprintln(buf, "digraph {")
+	fmt.Fprintln(buf, "\tnode [shape=box, fontname=\"monospace\"];")
+	ids := map[string]int{t.syntax(): 0}
+	queue := []term{t}
+	for len(queue) > 0 {
+		t, queue = queue[0], queue[1:]
+		id := ids[t.syntax()]
+		rs := reductions(t, true)
+		switch {
+		case isVal(t):
+			fmt.Fprintf(buf, "\tn%d [label=%q, peripheries=2];\n", id, t.syntax())
+		case len(rs) == 0:
+			fmt.Fprintf(buf, "\tn%d [label=%q, color=red];\n", id, t.syntax())
+		default:
+			fmt.Fprintf(buf, "\tn%d [label=%q];\n", id, t.syntax())
+		}
+		det, s, err := eval1Step(t)
+		for _, r := range rs {
+			rules := strings.Join(r.rules, " > ")
+			key := r.result.syntax()
+			next, ok := ids[key]
+			if !ok {
+				if len(ids) == graphNodes {
+					fmt.Fprintf(buf, "\t// stopped after %d terms\n", graphNodes)
+					queue = nil
+					break
+				}
+				next = len(ids)
+				ids[key] = next
+				queue = append(queue, r.result)
+			}
+			style := "dashed"
+			if err == nil && det.equal(r.result) && strings.Join(s.rules, " > ") == rules {
+				style = "solid"
+			}
+			fmt.Fprintf(buf, "\tn%d -> n%d [label=%q, style=%s];\n", id, next, rules, style)
+		}
+	}
+	fmt.Fprintln(buf, "}")
+	return buf.String()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// primOp is a primitive operator of fixed arity. Its arguments are evaluated
+// from left to right, after which one of its computation rules applies.
+type primOp struct {
+	name   string
+	params []ty
+	result ty
+	// step contracts the operator applied to the values args using one of
+	// its small-step computation rules, and returns the rule's name. It
+	// reports false if no rule applies.
+	step func(args []term) (rule string, res term, ok bool)
+	// eval computes the operator applied to the values args for the
+	// big-step evaluator. It reports false if no rule applies.
+	eval func(args []term) (term, bool)
+}
+
+// prims is the registry of primitive operators. The term type of prims[i] is
+// tmPrim+i.
+var prims []primOp
+
+func init() {
+	// The rules refer to other operators by name, so the registry is
+	// filled in here to avoid an initialization cycle.
+	prims = []primOp{
+		{
+			name:   "plus",
+			params: []ty{tyNat, tyNat},
+			result: tyNat,
+			step: func(args []term) (string, term, bool) {
+				switch nv1, nv2 := args[0], args[1]; {
+				case !isNumericVal(nv1) || !isNumericVal(nv2):
+				case nv1.tmType == tmZero:
+					return "E-PlusZero", nv2, true
+				default:
+					return "E-PlusSucc", mkSucc(mkPrim("plus", nv1.children[0], nv2)), true
+				}
+				return "", term{}, false
+			},
+			eval: natOp(func(n1, n2 int) term { return mkNat(n1 + n2) }),
+		},
+		{
+			name:   "times",
+			params: []ty{tyNat, tyNat},
+			result: tyNat,
+			step: func(args []term) (string, term, bool) {
+				switch nv1, nv2 := args[0], args[1]; {
+				case !isNumericVal(nv1) || !isNumericVal(nv2):
+				case nv1.tmType == tmZero:
+					return "E-TimesZero", nv1, true
+				default:
+					return "E-TimesSucc", mkPrim("plus", nv2, mkPrim("times", nv1.children[0], nv2)), true
+				}
+				return "", term{}, false
+			},
+			eval: natOp(func(n1, n2 int) term { return mkNat(n1 * n2) }),
+		},
+		{
+			name:   "eq",
+			params: []ty{tyNat, tyNat},
+			result: tyBool,
+			step: func(args []term) (string, term, bool) {
+				switch nv1, nv2 := args[0], args[1]; {
+				case !isNumericVal(nv1) || !isNumericVal(nv2):
+				case nv1.tmType == tmZero && nv2.tmType == tmZero:
+					return "E-EqZeroZero", term{tmType: tmTrue}, true
+				case nv1.tmType == tmZero:
+					return "E-EqZeroSucc", term{tmType: tmFalse}, true
+				case nv2.tmType == tmZero:
+					return "E-EqSuccZero", term{tmType: tmFalse}, true
+				default:
+					return "E-EqSuccSucc", mkPrim("eq", nv1.children[0], nv2.children[0]), true
+				}
+				return "", term{}, false
+			},
+			eval: natOp(func(n1, n2 int) term { return mkBool(n1 == n2) }),
+		},
+		{
+			name:   "le",
+			params: []ty{tyNat, tyNat},
+			result: tyBool,
+			step: func(args []term) (string, term, bool) {
+				switch nv1, nv2 := args[0], args[1]; {
+				case !isNumericVal(nv1) || !isNumericVal(nv2):
+				case nv1.tmType == tmZero:
+					return "E-LeZero", term{tmType: tmTrue}, true
+				case nv2.tmType == tmZero:
+					return "E-LeSuccZero", term{tmType: tmFalse}, true
+				default:
+					return "E-LeSuccSucc", mkPrim("le", nv1.children[0], nv2.children[0]), true
+				}
+				return "", term{}, false
+			},
+			eval: natOp(func(n1, n2 int) term { return mkBool(n1 <= n2) }),
+		},
+	}
+}
+
+// natOp lifts f to the big-step behavior of an operator on two numeric
+// values.
+func natOp(f func(n1, n2 int) term) func(args []term) (term, bool) {
+	return func(args []term) (term, bool) {
+		if !isNumericVal(args[0]) || !isNumericVal(args[1]) {
+			return term{}, false
+		}
+		return f(natValue(args[0]), natValue(args[1])), true
+	}
+}
+
+func (t tmType) prim() (primOp, bool) {
+	if t < tmPrim || int(t-tmPrim) >= len(prims) {
+		return primOp{}, false
+	}
+	return prims[t-tmPrim], true
+}
+
+func lookupPrim(name string) (tmType, bool) {
+	for i, p := range prims {
+		if p.name == name {
+			return tmPrim + tmType(i), true
+		}
+	}
+	return 0, false
+}
+
+// ruleName returns the name of p as it appears in the names of its rules.
+func (p primOp) ruleName() string {
+	return strings.ToUpper(p.name[:1]) + p.name[1:]
+}
+
+func mkPrim(name string, args ...term) term {
+	tmType, ok := lookupPrim(name)
+	if !ok {
+		panic(fmt.Sprintf("unknown primitive operator %q", name))
+	}
+	return term{tmType: tmType, children: args}
+}
+
+func mkSucc(t term) term {
+	return term{tmType: tmSucc, children: []term{t}}
+}
+
+func mkNat(n int) term {
+	t := term{tmType: tmZero}
+	for ; n > 0; n-- {
+		t = mkSucc(t)
+	}
+	return t
+}
+
+func mkBool(b bool) term {
+	if b {
+		return term{tmType: tmTrue}
+	}
+	return term{tmType: tmFalse}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// This file parses terms in the tree format printed by term.String, so that
+// printed results can be read back in.
+
+type treeLine struct {
+	text  string
+	start int
+}
+
+type treeParser struct {
+	src   string
+	lines []treeLine
+	i     int
+}
+
+// isTree reports whether src is in tree format: every line holds a single
+// node label, after the connectors that mark it as a child. Without any
+// connectors, every label must be a constant, because a file such as succ
+// on one line and 0 on the next is a term in the usual syntax.
+func isTree(src string) bool {
+	lines, connectors, leaves := 0, false, true
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			continue
+		}
+		lines++
+		label := strings.TrimLeft(line, "│ ")
+		if strings.HasPrefix(label, "├─") || strings.HasPrefix(label, "└─") {
+			label = label[len("├─"):]
+			connectors = true
+		} else if label != line {
+			return false
+		}
+		arity, ok := labelArity(label)
+		if !ok {
+			return false
+		}
+		leaves = leaves && arity == 0
+	}
+	return lines > 0 && (connectors || leaves)
+}
+
+// labelArity returns the number of children of a node with the given label.
+func labelArity(label string) (int, bool) {
+	switch label {
+	case "true", "false":
+		return 0, true
+	case "succ", "pred", "iszero":
+		return 1, true
+	case "if":
+		return 3, true
+	}
+	if tmType, ok := lookupPrim(label); ok {
+		p, _ := tmType.prim()
+		return len(p.params), true
+	}
+	return 0, label != "" && isNumeral(label)
+}
+
+// parseTree parses one or more terms in tree format, each starting on a line
+// of its own.
+func parseTree(src string) ([]term, error) {
+	p := &treeParser{src: src}
+	for start := 0; start < len(src); {
+		end := strings.IndexByte(src[start:], '\n')
+		if end < 0 {
+			end = len(src)
+		} else {
+			end += start
+		}
+		if text := strings.TrimRight(src[start:end], " \t\r"); text != "" {
+			p.lines = append(p.lines, treeLine{text, start})
+		}
+		start = end + 1
+	}
+	if len(p.lines) == 0 {
+		return nil, syntaxError{span{len(src), len(src)}, fmt.Sprintf("unexpected token %q", tEOF)}
+	}
+	var ts []term
+	for p.i < len(p.lines) {
+		t, err := p.parse("", 0)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// parse parses the node on the current line, whose label starts at byte
+// offset col, followed by the lines of its children, which start with indent.
+func (p *treeParser) parse(indent string, col int) (t term, err error) {
+	l := p.lines[p.i]
+	p.i++
+	label := l.text[col:]
+	t.span = span{l.start + col, l.start + len(l.text)}
+	arity := 0
+	switch label {
+	case "true":
+		t.tmType = tmTrue
+	case "false":
+		t.tmType = tmFalse
+	case "succ":
+		t.tmType, arity = tmSucc, 1
+	case "pred":
+		t.tmType, arity = tmPred, 1
+	case "iszero":
+		t.tmType, arity = tmIsZero, 1
+	case "if":
+		t.tmType, arity = tmIf, 3
+	default:
+		if tmType, ok := lookupPrim(label); ok {
+			p, _ := tmType.prim()
+			t.tmType, arity = tmType, len(p.params)
+			break
+		}
+		if label == "" || !isNumeral(label) {
+			return t, syntaxError{t.span, fmt.Sprintf("unexpected token %q", label)}
+		}
+		n, ok := parseNumeral(label)
+		if !ok {
+			return t, syntaxError{t.span, fmt.Sprintf("numeral %s out of range", label)}
+		}
+		sp := t.span
+		t = mkNat(n)
+		t.span = sp
+	}
+	for k := 0; k < arity; k++ {
+		branch, next := "├─", "│ "
+		if k == arity-1 {
+			branch, next = "└─", "  "
+		}
+		if p.i == len(p.lines) {
+			return t, syntaxError{span{len(p.src), len(p.src)}, fmt.Sprintf("expected argument %d of %q, got %q", k+1, label, tEOF)}
+		}
+		if l := p.lines[p.i]; !strings.HasPrefix(l.text, indent+branch) {
+			return t, syntaxError{span{l.start, l.start + len(l.text)}, fmt.Sprintf("expected argument %d of %q, got %q", k+1, label, l.text)}
+		}
+		c, err := p.parse(indent+next, len(indent+branch))
+		if err != nil {
+			return t, err
+		}
+		t.children = append(t.children, c)
+	}
+	return t, nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// This file implements a second back end that compiles a term to bytecode
+// for a small stack machine.
+
+type opcode byte
+
+const (
+	opTrue opcode = iota
+	opFalse
+	opZero
+	opSucc
+	opPred
+	opIsZero
+	opPrim        // followed by a one-byte index into prims
+	opJump        // followed by a four-byte target address
+	opJumpIfFalse // followed by a four-byte target address
+)
+
+func (op opcode) String() string {
+	switch op {
+	case opTrue:
+		return "true"
+	case opFalse:
+		return "false"
+	case opZero:
+		return "zero"
+	case opSucc:
+		return "succ"
+	case opPred:
+		return "pred"
+	case opIsZero:
+		return "iszero"
+	case opPrim:
+		return "prim"
+	case opJump:
+		return "jump"
+	case opJumpIfFalse:
+		return "jumpiffalse"
+	}
+	panic("unreachable")
+}
+
+// program is compiled bytecode. For every instruction that can get stuck,
+// source records the term it was compiled from, so that stuck programs are
+// reported in terms of the source, and leftover records the term that
+// evalBigStep returns when it gets stuck there.
+type program struct {
+	code     []byte
+	source   map[int]term
+	leftover map[int]term
+}
+
+func compile(t term) program {
+	p := program{source: make(map[int]term), leftover: make(map[int]term)}
+	p.compile(t, t, true)
+	return p
+}
+
+func (p *program) emit(op opcode, t, root term) int {
+	pc := len(p.code)
+	p.code = append(p.code, byte(op))
+	switch op {
+	case opSucc, opPred, opIsZero, opPrim, opJumpIfFalse:
+		p.source[pc] = t
+		p.leftover[pc] = root
+	}
+	return pc
+}
+
+func (p *program) emitJump(op opcode, t, root term) int {
+	pc := p.emit(op, t, root)
+	p.code = append(p.code, 0, 0, 0, 0)
+	return pc
+}
+
+// patch sets the target of the jump at pc to the end of the program.
+func (p *program) patch(pc int) {
+	binary.BigEndian.PutUint32(p.code[pc+1:], uint32(len(p.code)))
+}
+
+// compile compiles t, a subterm of root. If evaluation gets stuck in t,
+// evalBigStep returns root. This is t itself if isRoot is set, which is the
+// case for the whole term and for the branches of an if that is a root,
+// because evalBigStep evaluates those in place of the if.
+func (p *program) compile(t, root term, isRoot bool) {
+	branch := func(ti term) {
+		if isRoot {
+			p.compile(ti, ti, true)
+		} else {
+			p.compile(ti, root, false)
+		}
+	}
+	switch t.tmType {
+	case tmTrue:
+		p.emit(opTrue, t, root)
+	case tmFalse:
+		p.emit(opFalse, t, root)
+	case tmZero:
+		p.emit(opZero, t, root)
+	case tmSucc:
+		p.compile(t.children[0], root, false)
+		p.emit(opSucc, t, root)
+	case tmPred:
+		p.compile(t.children[0], root, false)
+		p.emit(opPred, t, root)
+	case tmIsZero:
+		p.compile(t.children[0], root, false)
+		p.emit(opIsZero, t, root)
+	case tmIf:
+		p.compile(t.children[0], root, false)
+		elseJump := p.emitJump(opJumpIfFalse, t, root)
+		branch(t.children[1])
+		endJump := p.emitJump(opJump, t, root)
+		p.patch(elseJump)
+		branch(t.children[2])
+		p.patch(endJump)
+	default:
+		for _, ti := range t.children {
+			p.compile(ti, root, false)
+		}
+		p.emit(opPrim, t, root)
+		p.code = append(p.code, byte(t.tmType-tmPrim))
+	}
+}
+
+func (p program) String() string {
+	buf := new(strings.Builder)
+	for pc := 0; pc < len(p.code); {
+		op := opcode(p.code[pc])
+		fmt.Fprintf(buf, "%04d  %s", pc, op)
+		pc++
+		switch op {
+		case opPrim:
+			fmt.Fprintf(buf, " %s", prims[p.code[pc]].name)
+			pc++
+		case opJump, opJumpIfFalse:
+			fmt.Fprintf(buf, " %04d", binary.BigEndian.Uint32(p.code[pc:]))
+			pc += 4
+		}
+		fmt.Fprintln(buf)
+	}
+	return buf.String()
+}
+
+// value is a value on the stack of the machine: a boolean or a number.
+type value struct {
+	isBool bool
+	n      int
+}
+
+func (v value) term() term {
+	if v.isBool {
+		return mkBool(v.n != 0)
+	}
+	return mkNat(v.n)
+}
+
+func valueOf(t term) value {
+	switch t.tmType {
+	case tmTrue:
+		return value{isBool: true, n: 1}
+	case tmFalse:
+		return value{isBool: true}
+	}
+	return value{n: natValue(t)}
+}
+
+// run executes p and returns the value left on the stack. If no rule applies
+// to some subterm, it returns the same term and stuckError as evalBigStep.
+func (p program) run() (term, error) {
+	var stack []value
+	pop := func() value {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v
+	}
+	stuckAt := func(pc int, vs ...value) error {
+		t := p.source[pc]
+		children := make([]term, len(vs))
+		for i, v := range vs {
+			children[i] = v.term()
+		}
+		if t.tmType == tmIf {
+			children = append(children, t.children[1:]...)
+		}
+		return stuckError{term{tmType: t.tmType, children: children, span: t.span}}
+	}
+	for pc := 0; pc < len(p.code); {
+		op := opcode(p.code[pc])
+		switch op {
+		case opTrue:
+			stack = append(stack, value{isBool: true, n: 1})
+		case opFalse:
+			stack = append(stack, value{isBool: true})
+		case opZero:
+			stack = append(stack, value{})
+		case opSucc, opPred, opIsZero:
+			v := pop()
+			if v.isBool {
+				return p.leftover[pc], stuckAt(pc, v)
+			}
+			switch op {
+			case opSucc:
+				v.n++
+			case opPred:
+				if v.n > 0 {
+					v.n--
+				}
+			case opIsZero:
+				v = valueOf(mkBool(v.n == 0))
+			}
+			stack = append(stack, v)
+		case opPrim:
+			prim := prims[p.code[pc+1]]
+			args := make([]value, len(prim.params))
+			for i := len(args) - 1; i >= 0; i-- {
+				args[i] = pop()
+			}
+			vs := make([]term, len(args))
+			for i, v := range args {
+				vs[i] = v.term()
+			}
+			res, ok := prim.eval(vs)
+			if !ok {
+				return p.leftover[pc], stuckAt(pc, args...)
+			}
+			stack = append(stack, valueOf(res))
+			pc += 2
+			continue
+		case opJump:
+			pc = int(binary.BigEndian.Uint32(p.code[pc+1:]))
+			continue
+		case opJumpIfFalse:
+			v := pop()
+			if !v.isBool {
+				return p.leftover[pc], stuckAt(pc, v)
+			}
+			if v.n == 0 {
+				pc = int(binary.BigEndian.Uint32(p.code[pc+1:]))
+			} else {
+				pc += 5
+			}
+			continue
+		}
+		pc++
+	}
+	return pop().term(), nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import "fmt"
+
+// This file implements the alternative semantics of TAPL exercise 3.5.16, in
+// which misapplied operators step to wrong instead of getting stuck.
+
+func isBadNat(t term) bool {
+	switch t.tmType {
+	case tmWrong, tmTrue, tmFalse:
+		return true
+	default:
+		return false
+	}
+}
+
+func isBadBool(t term) bool {
+	return t.tmType == tmWrong || isNumericVal(t)
+}
+
+func eval1Wrong(t term) (res term, err error) {
+	wrongTerm := term{tmType: tmWrong}
+	switch t.tmType {
+	case tmIf:
+		switch t1 := t.children[0]; {
+		case t1.tmType == tmTrue:
+			return t.children[1], nil
+		case t1.tmType == tmFalse:
+			return t.children[2], nil
+		case isBadBool(t1):
+			return wrongTerm, nil
+		default:
+			t1Prime, err := eval1Wrong(t1)
+			if err != nil {
+				return res, err
+			}
+			return term{tmType: tmIf, children: []term{t1Prime, t.children[1], t.children[2]}}, nil
+		}
+	case tmSucc:
+		if isBadNat(t.children[0]) {
+			return wrongTerm, nil
+		}
+		t1Prime, err := eval1Wrong(t.children[0])
+		if err != nil {
+			return res, err
+		}
+		return term{tmType: tmSucc, children: []term{t1Prime}}, nil
+	case tmPred:
+		switch t1 := t.children[0]; {
+		case t1.tmType == tmZero:
+			return term{tmType: tmZero}, nil
+		case t1.tmType == tmSucc && isNumericVal(t1.children[0]):
+			return t1.children[0], nil
+		case isBadNat(t1):
+			return wrongTerm, nil
+		default:
+			t1Prime, err := eval1Wrong(t1)
+			if err != nil {
+				return res, err
+			}
+			return term{tmType: tmPred, children: []term{t1Prime}}, nil
+		}
+	case tmIsZero:
+		switch t1 := t.children[0]; {
+		case t1.tmType == tmZero:
+			return term{tmType: tmTrue}, nil
+		case t1.tmType == tmSucc && isNumericVal(t1.children[0]):
+			return term{tmType: tmFalse}, nil
+		case isBadNat(t1):
+			return wrongTerm, nil
+		default:
+			t1Prime, err := eval1Wrong(t1)
+			if err != nil {
+				return res, err
+			}
+			return term{tmType: tmIsZero, children: []term{t1Prime}}, nil
+		}
+	}
+	if p, ok := t.tmType.prim(); ok {
+		for i, ti := range t.children {
+			if p.params[i] == tyNat && isBadNat(ti) || p.params[i] == tyBool && isBadBool(ti) {
+				return wrongTerm, nil
+			}
+			if !isVal(ti) {
+				tiPrime, err := eval1Wrong(ti)
+				if err != nil {
+					return res, err
+				}
+				children := append([]term(nil), t.children...)
+				children[i] = tiPrime
+				return term{tmType: t.tmType, children: children}, nil
+			}
+		}
+		if _, res, ok := p.step(t.children); ok {
+			return res, nil
+		}
+	}
+	return res, noRuleApplies
+}
+
+func evalWrong(t term) term {
+	t1Prime, err := eval1Wrong(t)
+	if err != nil {
+		return t
+	}
+	return evalWrong(t1Prime)
+}
+
+// compareWrong evaluates t under both semantics and prints the outcomes. It
+// fails unless t is stuck under the original rules exactly when it evaluates
+// to wrong, and otherwise reaches the same value under both.
+func compareWrong(t term) error {
+	nf := evalSmallStep(t)
+	w := evalWrong(t)
+	if err := stuck(nf); err != nil {
+		fmt.Printf("original: %v\n", err)
+	} else {
+		fmt.Printf("original: %s\n", nf.syntax())
+	}
+	fmt.Printf("wrong:    %s\n", w.syntax())
+	switch isStuck, isWrong := stuck(nf) != nil, w.tmType == tmWrong; {
+	case isStuck && !isWrong:
+		return fmt.Errorf("%q is stuck but does not evaluate to wrong", t.syntax())
+	case !isStuck && isWrong:
+		return fmt.Errorf("%q evaluates to wrong but is not stuck", t.syntax())
+	case !isStuck && !nf.equal(w):
+		return fmt.Errorf("%q evaluates to different values", t.syntax())
+	}
+	return nil
+}
@@ -0,0 +1,649 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+	"golang.org/x/exp/slices"
+)
+
+var (
+	smallStep = flag.Bool("small-step", false, "run small-step evaluator")
+	bigStep   = flag.Bool("big-step", false, "run big-step evaluator")
+)
+
+func usage() {
+	fmt.Fprint(os.Stderr, "usage: fulluntyped ( -small-step | -big-step ) file\n\n")
+	fmt.Fprint(os.Stderr, "fulluntyped is an implementation of the untyped lambda calculus with booleans, numbers, records, strings, floats and let (TAPL chapters 5-7).\n")
+	os.Exit(2)
+}
+
+func errExit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func unexpected(s string) {
+	errExit(fmt.Errorf("unexpected token %q", s))
+}
+
+type Term interface {
+	isTerm()
+	DeBruijnString() string
+	ContextString(ctx []Context) string
+}
+
+type True struct{}
+
+func (True) isTerm()                          {}
+func (t True) DeBruijnString() string         { return "true" }
+func (t True) ContextString([]Context) string { return "true" }
+
+type False struct{}
+
+func (False) isTerm()                          {}
+func (t False) DeBruijnString() string         { return "false" }
+func (t False) ContextString([]Context) string { return "false" }
+
+type If struct {
+	Cond Term
+	Body Term
+	Else Term
+}
+
+func (If) isTerm() {}
+
+func (i If) DeBruijnString() string {
+	return "(if " + i.Cond.DeBruijnString() + " then " + i.Body.DeBruijnString() + " else " + i.Else.DeBruijnString() + ")"
+}
+
+func (i If) ContextString(ctx []Context) string {
+	return "(if " + i.Cond.ContextString(ctx) + " then " + i.Body.ContextString(ctx) + " else " + i.Else.ContextString(ctx) + ")"
+}
+
+type Var int
+
+func (Var) isTerm() {}
+
+func (v Var) DeBruijnString() string {
+	return strconv.Itoa(int(v))
+}
+
+func (v Var) ContextString(ctx []Context) string {
+	return ctx[v].Name
+}
+
+type Abs struct {
+	OldBind string
+	Body    Term
+}
+
+func (Abs) isTerm() {}
+
+func (a Abs) DeBruijnString() string {
+	return "(λ." + a.Body.DeBruijnString() + ")"
+}
+
+func contains(ctx []Context, s string) bool {
+	return slices.IndexFunc(ctx, func(c Context) bool { return c.Name == s }) >= 0
+}
+
+func pickFreshName(ctx []Context, s string) ([]Context, string) {
+	if contains(ctx, s) {
+		return pickFreshName(ctx, s+"'")
+	}
+	return addBinding(ctx, s, NameBind{}), s
+}
+
+func (a Abs) ContextString(ctx []Context) string {
+	ctx, oldBind := pickFreshName(ctx, a.OldBind)
+	return "(λ" + oldBind + "." + a.Body.ContextString(ctx) + ")"
+}
+
+type App struct {
+	Fn  Term
+	Arg Term
+}
+
+func (App) isTerm() {}
+
+func (a App) DeBruijnString() string {
+	return "(" + a.Fn.DeBruijnString() + " " + a.Arg.DeBruijnString() + ")"
+}
+
+func (a App) ContextString(ctx []Context) string {
+	return "(" + a.Fn.ContextString(ctx) + " " + a.Arg.ContextString(ctx) + ")"
+}
+
+type Record []Field
+
+type Field struct {
+	Label string
+	Term  Term
+}
+
+func (Record) isTerm() {}
+
+// fieldString prints the i'th field of a record, leaving out labels that
+// are the field's position.
+func (r Record) fieldString(i int, term func(Term) string) string {
+	if r[i].Label == strconv.Itoa(i+1) {
+		return term(r[i].Term)
+	}
+	return r[i].Label + "=" + term(r[i].Term)
+}
+
+func (r Record) DeBruijnString() string {
+	return "{" + strings.Join(lo.Map(r, func(_ Field, i int) string {
+		return r.fieldString(i, Term.DeBruijnString)
+	}), ", ") + "}"
+}
+
+func (r Record) ContextString(ctx []Context) string {
+	return "{" + strings.Join(lo.Map(r, func(_ Field, i int) string {
+		return r.fieldString(i, func(t Term) string { return t.ContextString(ctx) })
+	}), ", ") + "}"
+}
+
+type Proj struct {
+	T     Term
+	Label string
+}
+
+func (Proj) isTerm() {}
+
+func (p Proj) DeBruijnString() string {
+	return p.T.DeBruijnString() + "." + p.Label
+}
+
+func (p Proj) ContextString(ctx []Context) string {
+	return p.T.ContextString(ctx) + "." + p.Label
+}
+
+type String string
+
+func (String) isTerm()                              {}
+func (s String) DeBruijnString() string             { return strconv.Quote(string(s)) }
+func (s String) ContextString(ctx []Context) string { return strconv.Quote(string(s)) }
+
+type Float float64
+
+func (Float) isTerm() {}
+
+// DeBruijnString prints f with a decimal point, so that it is not mistaken
+// for a number.
+func (f Float) DeBruijnString() string {
+	s := strconv.FormatFloat(float64(f), 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+func (f Float) ContextString(ctx []Context) string { return f.DeBruijnString() }
+
+type TimesFloat struct {
+	T1 Term
+	T2 Term
+}
+
+func (TimesFloat) isTerm() {}
+
+func (t TimesFloat) DeBruijnString() string {
+	return "(timesfloat " + t.T1.DeBruijnString() + " " + t.T2.DeBruijnString() + ")"
+}
+
+func (t TimesFloat) ContextString(ctx []Context) string {
+	return "(timesfloat " + t.T1.ContextString(ctx) + " " + t.T2.ContextString(ctx) + ")"
+}
+
+type Let struct {
+	X   string
+	T   Term
+	InT Term
+}
+
+func (Let) isTerm() {}
+
+func (l Let) DeBruijnString() string {
+	return "(let " + l.T.DeBruijnString() + " in " + l.InT.DeBruijnString() + ")"
+}
+
+func (l Let) ContextString(ctx []Context) string {
+	ctx1, x := pickFreshName(ctx, l.X)
+	return "(let " + x + " = " + l.T.ContextString(ctx) + " in " + l.InT.ContextString(ctx1) + ")"
+}
+
+type Zero struct{}
+
+func (Zero) isTerm() {}
+
+func (Zero) DeBruijnString() string             { return "0" }
+func (Zero) ContextString(ctx []Context) string { return "0" }
+
+// Succ prints as a number if it is a numeric value.
+type Succ struct {
+	T Term
+}
+
+func (Succ) isTerm() {}
+
+func (s Succ) DeBruijnString() string {
+	if n, ok := natValue(s); ok {
+		return strconv.Itoa(n)
+	}
+	return "(succ " + s.T.DeBruijnString() + ")"
+}
+
+func (s Succ) ContextString(ctx []Context) string {
+	if n, ok := natValue(s); ok {
+		return strconv.Itoa(n)
+	}
+	return "(succ " + s.T.ContextString(ctx) + ")"
+}
+
+type Pred struct {
+	T Term
+}
+
+func (Pred) isTerm() {}
+
+func (p Pred) DeBruijnString() string {
+	return "(pred " + p.T.DeBruijnString() + ")"
+}
+
+func (p Pred) ContextString(ctx []Context) string {
+	return "(pred " + p.T.ContextString(ctx) + ")"
+}
+
+type IsZero struct {
+	T Term
+}
+
+func (IsZero) isTerm() {}
+
+func (i IsZero) DeBruijnString() string {
+	return "(iszero " + i.T.DeBruijnString() + ")"
+}
+
+func (i IsZero) ContextString(ctx []Context) string {
+	return "(iszero " + i.T.ContextString(ctx) + ")"
+}
+
+type Context struct {
+	Name    string
+	Binding Binding
+}
+
+type Binding interface {
+	isBinding()
+}
+
+type NameBind struct{}
+
+func (NameBind) isBinding() {}
+
+// TmAbbBind binds a name to a term, which is in the context that the name
+// is added to.
+type TmAbbBind struct {
+	Term Term
+}
+
+func (TmAbbBind) isBinding() {}
+
+func addBinding(ctx []Context, name string, bind Binding) []Context {
+	return prepend(Context{name, bind}, ctx)
+}
+
+func prepend[T any](v T, from []T) []T {
+	return append([]T{v}, from...)
+}
+
+// getBinding returns the term bound to Var(i), shifted into ctx.
+func getBinding(ctx []Context, i int) (Term, bool) {
+	if bind, ok := ctx[i].Binding.(TmAbbBind); ok {
+		return shift(i+1, 0, bind.Term), true
+	}
+	return nil, false
+}
+
+type Command interface {
+	isCommand()
+}
+
+type Eval struct {
+	Term Term
+}
+
+func (Eval) isCommand() {}
+
+type Bind struct {
+	Name    string
+	Binding Binding
+}
+
+func (Bind) isCommand() {}
+
+// mapTerm rebuilds t by applying onVar to each variable, with c the number
+// of binders it is under.
+func mapTerm(onVar func(c int, v Var) Term, c int, t Term) Term {
+	walk := func(t Term) Term { return mapTerm(onVar, c, t) }
+	switch t := t.(type) {
+	case Var:
+		return onVar(c, t)
+	case Abs:
+		return Abs{t.OldBind, mapTerm(onVar, c+1, t.Body)}
+	case App:
+		return App{walk(t.Fn), walk(t.Arg)}
+	case If:
+		return If{walk(t.Cond), walk(t.Body), walk(t.Else)}
+	case Let:
+		return Let{t.X, walk(t.T), mapTerm(onVar, c+1, t.InT)}
+	case Record:
+		return Record(lo.Map(t, func(f Field, _ int) Field { return Field{f.Label, walk(f.Term)} }))
+	case Proj:
+		return Proj{walk(t.T), t.Label}
+	case TimesFloat:
+		return TimesFloat{walk(t.T1), walk(t.T2)}
+	case Succ:
+		return Succ{walk(t.T)}
+	case Pred:
+		return Pred{walk(t.T)}
+	case IsZero:
+		return IsZero{walk(t.T)}
+	case True, False, Zero, String, Float:
+		return t
+	}
+	panic("unreachable")
+}
+
+func shift(d, c int, t Term) Term {
+	return mapTerm(func(c int, v Var) Term {
+		if int(v) < c {
+			return v
+		}
+		return v + Var(d)
+	}, c, t)
+}
+
+func subst(j int, s, t Term) Term {
+	return mapTerm(func(c int, v Var) Term {
+		if int(v) == j+c {
+			return shift(c, 0, s)
+		}
+		return v
+	}, 0, t)
+}
+
+func substTop(s, t Term) Term {
+	return shift(-1, 0, subst(0, shift(1, 0, s), t))
+}
+
+func natValue(t Term) (int, bool) {
+	switch t := t.(type) {
+	case Zero:
+		return 0, true
+	case Succ:
+		n, ok := natValue(t.T)
+		return n + 1, ok
+	}
+	return 0, false
+}
+
+func isNumericVal(t Term) bool {
+	_, ok := natValue(t)
+	return ok
+}
+
+func isVal(t Term) bool {
+	switch t := t.(type) {
+	case Abs, True, False, String, Float:
+		return true
+	case Record:
+		return lo.EveryBy(t, func(f Field) bool { return isVal(f.Term) })
+	}
+	return isNumericVal(t)
+}
+
+var noRuleApplies = fmt.Errorf("no rule applies")
+
+func eval1(ctx []Context, t Term) (Term, error) {
+	switch t := t.(type) {
+	case Var:
+		if t, ok := getBinding(ctx, int(t)); ok {
+			return t, nil
+		}
+	case If:
+		switch t.Cond.(type) {
+		case True:
+			return t.Body, nil
+		case False:
+			return t.Else, nil
+		}
+		t1Prime, err := eval1(ctx, t.Cond)
+		if err != nil {
+			return nil, err
+		}
+		return If{t1Prime, t.Body, t.Else}, nil
+	case App:
+		if abs, ok := t.Fn.(Abs); ok && isVal(t.Arg) {
+			return substTop(t.Arg, abs.Body), nil
+		}
+		if isVal(t.Fn) {
+			t2Prime, err := eval1(ctx, t.Arg)
+			if err != nil {
+				return nil, err
+			}
+			return App{t.Fn, t2Prime}, nil
+		}
+		t1Prime, err := eval1(ctx, t.Fn)
+		if err != nil {
+			return nil, err
+		}
+		return App{t1Prime, t.Arg}, nil
+	case Let:
+		if isVal(t.T) {
+			return substTop(t.T, t.InT), nil
+		}
+		t1Prime, err := eval1(ctx, t.T)
+		if err != nil {
+			return nil, err
+		}
+		return Let{t.X, t1Prime, t.InT}, nil
+	case Record:
+		for i, f := range t {
+			if !isVal(f.Term) {
+				t1Prime, err := eval1(ctx, f.Term)
+				if err != nil {
+					return nil, err
+				}
+				r := slices.Clone(t)
+				r[i].Term = t1Prime
+				return r, nil
+			}
+		}
+	case Proj:
+		if r, ok := t.T.(Record); ok && isVal(r) {
+			i := slices.IndexFunc(r, func(f Field) bool { return f.Label == t.Label })
+			if i < 0 {
+				return nil, noRuleApplies
+			}
+			return r[i].Term, nil
+		}
+		t1Prime, err := eval1(ctx, t.T)
+		if err != nil {
+			return nil, err
+		}
+		return Proj{t1Prime, t.Label}, nil
+	case TimesFloat:
+		f1, ok1 := t.T1.(Float)
+		f2, ok2 := t.T2.(Float)
+		if ok1 && ok2 {
+			return f1 * f2, nil
+		}
+		if ok1 {
+			t2Prime, err := eval1(ctx, t.T2)
+			if err != nil {
+				return nil, err
+			}
+			return TimesFloat{t.T1, t2Prime}, nil
+		}
+		t1Prime, err := eval1(ctx, t.T1)
+		if err != nil {
+			return nil, err
+		}
+		return TimesFloat{t1Prime, t.T2}, nil
+	case Succ:
+		t1Prime, err := eval1(ctx, t.T)
+		if err != nil {
+			return nil, err
+		}
+		return Succ{t1Prime}, nil
+	case Pred:
+		if _, ok := t.T.(Zero); ok {
+			return Zero{}, nil
+		}
+		if succ, ok := t.T.(Succ); ok && isNumericVal(succ.T) {
+			return succ.T, nil
+		}
+		t1Prime, err := eval1(ctx, t.T)
+		if err != nil {
+			return nil, err
+		}
+		return Pred{t1Prime}, nil
+	case IsZero:
+		if _, ok := t.T.(Zero); ok {
+			return True{}, nil
+		}
+		if succ, ok := t.T.(Succ); ok && isNumericVal(succ.T) {
+			return False{}, nil
+		}
+		t1Prime, err := eval1(ctx, t.T)
+		if err != nil {
+			return nil, err
+		}
+		return IsZero{t1Prime}, nil
+	}
+	return nil, noRuleApplies
+}
+
+func evalSmallStep(ctx []Context, t Term) Term {
+	for {
+		t1Prime, err := eval1(ctx, t)
+		if err != nil {
+			return t
+		}
+		t = t1Prime
+	}
+}
+
+// evalBigStep returns t unchanged if it gets stuck.
+func evalBigStep(ctx []Context, t Term) Term {
+	switch t1 := t.(type) {
+	case Var:
+		if t1, ok := getBinding(ctx, int(t1)); ok {
+			return evalBigStep(ctx, t1)
+		}
+	case If:
+		switch evalBigStep(ctx, t1.Cond).(type) {
+		case True:
+			return evalBigStep(ctx, t1.Body)
+		case False:
+			return evalBigStep(ctx, t1.Else)
+		}
+	case App:
+		v1 := evalBigStep(ctx, t1.Fn)
+		v2 := evalBigStep(ctx, t1.Arg)
+		if abs, ok := v1.(Abs); ok && isVal(v2) {
+			return evalBigStep(ctx, substTop(v2, abs.Body))
+		}
+	case Let:
+		if v1 := evalBigStep(ctx, t1.T); isVal(v1) {
+			return evalBigStep(ctx, substTop(v1, t1.InT))
+		}
+	case Record:
+		r := Record(lo.Map(t1, func(f Field, _ int) Field { return Field{f.Label, evalBigStep(ctx, f.Term)} }))
+		if isVal(r) {
+			return r
+		}
+	case Proj:
+		if r, ok := evalBigStep(ctx, t1.T).(Record); ok && isVal(r) {
+			if i := slices.IndexFunc(r, func(f Field) bool { return f.Label == t1.Label }); i >= 0 {
+				return r[i].Term
+			}
+		}
+	case TimesFloat:
+		f1, ok1 := evalBigStep(ctx, t1.T1).(Float)
+		f2, ok2 := evalBigStep(ctx, t1.T2).(Float)
+		if ok1 && ok2 {
+			return f1 * f2
+		}
+	case Succ:
+		if v := evalBigStep(ctx, t1.T); isNumericVal(v) {
+			return Succ{v}
+		}
+	case Pred:
+		switch v := evalBigStep(ctx, t1.T).(type) {
+		case Zero:
+			return v
+		case Succ:
+			if isNumericVal(v.T) {
+				return v.T
+			}
+		}
+	case IsZero:
+		switch v := evalBigStep(ctx, t1.T).(type) {
+		case Zero:
+			return True{}
+		case Succ:
+			if isNumericVal(v.T) {
+				return False{}
+			}
+		}
+	}
+	return t
+}
+
+func eval(ctx []Context, t Term) Term {
+	if *smallStep {
+		return evalSmallStep(ctx, t)
+	}
+	return evalBigStep(ctx, t)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *smallStep == *bigStep {
+		usage()
+	}
+	args := flag.Args()
+	if len(args) != 1 {
+		usage()
+	}
+	b, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		usage()
+	}
+	var ctx []Context
+	for _, cmd := range parseFile(scan(string(b))) {
+		switch cmd := cmd.(type) {
+		case Eval:
+			fmt.Println(eval(ctx, cmd.Term).ContextString(ctx))
+		case Bind:
+			if abb, ok := cmd.Binding.(TmAbbBind); ok {
+				t := eval(ctx, abb.Term)
+				fmt.Println(cmd.Name + " = " + t.ContextString(ctx))
+				ctx = addBinding(ctx, cmd.Name, TmAbbBind{t})
+			} else {
+				fmt.Println(cmd.Name)
+				ctx = addBinding(ctx, cmd.Name, cmd.Binding)
+			}
+		}
+	}
+}
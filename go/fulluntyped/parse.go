@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/exp/slices"
+)
+
+func isIdentStart(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_'
+}
+
+func isIdentRune(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r) || r == '\''
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// maxNumeral is the largest numeral accepted in source. Numerals are
+// expanded into nested succ terms, which the evaluators walk recursively.
+const maxNumeral = 1 << 16
+
+// parseNumeral returns the value of the numeral s, if it is at most
+// maxNumeral.
+func parseNumeral(s string) (int, bool) {
+	n, err := strconv.Atoi(s)
+	return n, err == nil && n <= maxNumeral
+}
+
+// scan splits src into tokens. String literals keep their quotes, and the
+// lambda may also be written \ or lambda. Comments are enclosed in /* */.
+func scan(src string) (tokens []string) {
+	for i := 0; i < len(src); {
+		r, n := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				errExit(fmt.Errorf("unterminated comment"))
+			}
+			n = end + 4
+		case strings.ContainsRune("(){},.;=/λ\\", r):
+			tokens = append(tokens, string(r))
+		case r == '"':
+			n = 1
+			for i+n < len(src) && src[i+n] != '"' {
+				if src[i+n] == '\\' {
+					n++
+				}
+				n++
+			}
+			if i+n >= len(src) {
+				errExit(fmt.Errorf("unterminated string"))
+			}
+			n++
+			tokens = append(tokens, src[i:i+n])
+		case isDigit(r):
+			n = digits(src[i:])
+			if strings.HasPrefix(src[i+n:], ".") && digits(src[i+n+1:]) > 0 {
+				n += 1 + digits(src[i+n+1:])
+			}
+			tokens = append(tokens, src[i:i+n])
+		case isIdentStart(r):
+			n = strings.IndexFunc(src[i:], func(r rune) bool { return !isIdentRune(r) })
+			if n < 0 {
+				n = len(src) - i
+			}
+			tokens = append(tokens, src[i:i+n])
+		default:
+			unexpected(string(r))
+		}
+		i += n
+	}
+	for i, tok := range tokens {
+		if tok == "\\" || tok == "lambda" {
+			tokens[i] = "λ"
+		}
+	}
+	return tokens
+}
+
+func digits(s string) int {
+	n := strings.IndexFunc(s, func(r rune) bool { return !isDigit(r) })
+	if n < 0 {
+		return len(s)
+	}
+	return n
+}
+
+var keywords = []string{"if", "then", "else", "true", "false", "let", "in", "succ", "pred", "iszero", "timesfloat"}
+
+func isIdent(tok string) bool {
+	r, _ := utf8.DecodeRuneInString(tok)
+	return isIdentStart(r) && !slices.Contains(keywords, tok) && tok != "EOF"
+}
+
+// parser parses the commands of a program. names holds the names of the
+// variables in scope, most recent first, starting with those bound by
+// abstractions and lets and ending with those bound by earlier commands.
+type parser struct {
+	tokens []string
+	names  []string
+}
+
+// peek returns the next token, or "EOF" at the end of the input.
+func (p *parser) peek() string {
+	if len(p.tokens) == 0 {
+		return "EOF"
+	}
+	return p.tokens[0]
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	if len(p.tokens) > 0 {
+		p.tokens = p.tokens[1:]
+	}
+	return tok
+}
+
+func (p *parser) expect(tok string) {
+	if got := p.next(); got != tok {
+		errExit(fmt.Errorf("expected token %q, got %q", tok, got))
+	}
+}
+
+func (p *parser) ident() string {
+	tok := p.next()
+	if !isIdent(tok) {
+		errExit(fmt.Errorf("expected identifier, got %q", tok))
+	}
+	return tok
+}
+
+// bind parses a term in the scope of name.
+func (p *parser) bind(name string) Term {
+	p.names = prepend(name, p.names)
+	t := p.term()
+	p.names = p.names[1:]
+	return t
+}
+
+// parseFile parses a sequence of commands separated by semicolons: a
+// declaration of a free variable name/, a definition name = term, or a term
+// to evaluate.
+func parseFile(tokens []string) (cmds []Command) {
+	p := &parser{tokens: tokens}
+	for len(p.tokens) > 0 {
+		if len(p.tokens) > 1 && isIdent(p.tokens[0]) && (p.tokens[1] == "/" || p.tokens[1] == "=") {
+			name, sep := p.next(), p.next()
+			var bind Binding = NameBind{}
+			if sep == "=" {
+				bind = TmAbbBind{p.term()}
+			}
+			cmds = append(cmds, Bind{name, bind})
+			p.names = prepend(name, p.names)
+		} else {
+			cmds = append(cmds, Eval{p.term()})
+		}
+		if len(p.tokens) == 0 {
+			break
+		}
+		p.expect(";")
+	}
+	return cmds
+}
+
+func (p *parser) term() Term {
+	switch p.peek() {
+	case "λ":
+		p.next()
+		name := p.ident()
+		p.expect(".")
+		return Abs{name, p.bind(name)}
+	case "if":
+		p.next()
+		cond := p.term()
+		p.expect("then")
+		body := p.term()
+		p.expect("else")
+		return If{cond, body, p.term()}
+	case "let":
+		p.next()
+		name := p.ident()
+		p.expect("=")
+		t := p.term()
+		p.expect("in")
+		return Let{name, t, p.bind(name)}
+	}
+	return p.appTerm()
+}
+
+// startsPath reports whether tok can start an argument of an application.
+func startsPath(tok string) bool {
+	switch tok {
+	case "(", "{", "true", "false":
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(tok)
+	return r == '"' || isDigit(r) || isIdent(tok)
+}
+
+func (p *parser) appTerm() Term {
+	var t Term
+	switch p.peek() {
+	case "succ":
+		p.next()
+		t = Succ{p.pathTerm()}
+	case "pred":
+		p.next()
+		t = Pred{p.pathTerm()}
+	case "iszero":
+		p.next()
+		t = IsZero{p.pathTerm()}
+	case "timesfloat":
+		p.next()
+		t1 := p.pathTerm()
+		t = TimesFloat{t1, p.pathTerm()}
+	default:
+		t = p.pathTerm()
+	}
+	for startsPath(p.peek()) {
+		t = App{t, p.pathTerm()}
+	}
+	return t
+}
+
+func (p *parser) pathTerm() Term {
+	t := p.aTerm()
+	for p.peek() == "." {
+		p.next()
+		label := p.next()
+		if !isIdent(label) && digits(label) != len(label) {
+			errExit(fmt.Errorf("expected label, got %q", label))
+		}
+		t = Proj{t, label}
+	}
+	return t
+}
+
+func (p *parser) aTerm() Term {
+	tok := p.next()
+	switch tok {
+	case "(":
+		t := p.term()
+		p.expect(")")
+		return t
+	case "{":
+		return p.fields()
+	case "true":
+		return True{}
+	case "false":
+		return False{}
+	}
+	r, _ := utf8.DecodeRuneInString(tok)
+	switch {
+	case r == '"':
+		s, err := strconv.Unquote(tok)
+		if err != nil {
+			errExit(fmt.Errorf("invalid string %s", tok))
+		}
+		return String(s)
+	case strings.Contains(tok, "."):
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			errExit(fmt.Errorf("invalid float %s", tok))
+		}
+		return Float(f)
+	case isDigit(r):
+		n, ok := parseNumeral(tok)
+		if !ok {
+			errExit(fmt.Errorf("numeral %s out of range", tok))
+		}
+		var t Term = Zero{}
+		for ; n > 0; n-- {
+			t = Succ{t}
+		}
+		return t
+	case isIdent(tok):
+		i := slices.Index(p.names, tok)
+		if i < 0 {
+			errExit(fmt.Errorf("undefined variable %q", tok))
+		}
+		return Var(i)
+	}
+	unexpected(tok)
+	panic("unreachable")
+}
+
+// fields parses the fields of a record after the {. Fields without a label
+// are labeled with their position, starting at 1.
+func (p *parser) fields() Record {
+	r := Record{}
+	if p.peek() == "}" {
+		p.next()
+		return r
+	}
+	for {
+		label := strconv.Itoa(len(r) + 1)
+		if len(p.tokens) > 1 && isIdent(p.tokens[0]) && p.tokens[1] == "=" {
+			label = p.next()
+			p.next()
+		}
+		r = append(r, Field{label, p.term()})
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+	p.expect("}")
+	return r
+}
@@ -0,0 +1,160 @@
+package main
+
+import "golang.org/x/exp/slices"
+
+// This file implements a CEK machine, which evaluates terms like
+// evalBigStep, but binds variables in environments instead of substituting
+// for them.
+
+// value is a value of the machine. readback converts it back into a term
+// that is placed under depth abstractions.
+type value interface {
+	readback(depth int) Term
+}
+
+// closure is an abstraction paired with the environment of its free
+// variables.
+type closure struct {
+	abs Abs
+	env *env
+}
+
+func (c *closure) readback(depth int) Term {
+	return readback(c.abs, c.env, 0, depth)
+}
+
+// neutral is a free variable declared with name/, applied to values. Its
+// index is relative to the top-level context.
+type neutral struct {
+	index int
+	args  []value
+}
+
+func (n *neutral) readback(depth int) Term {
+	var t Term = Var(n.index + depth)
+	for _, arg := range n.args {
+		t = App{t, arg.readback(depth)}
+	}
+	return t
+}
+
+// env is a linked list of values, in which the value of Var(i) is the i'th.
+type env struct {
+	v    value
+	next *env
+}
+
+func (e *env) lookup(i int) value {
+	for ; i > 0; i-- {
+		e = e.next
+	}
+	return e.v
+}
+
+// frame is a continuation frame. If fn is nil, the machine is evaluating
+// the function of an application, and will evaluate arg in argEnv next.
+// Otherwise it is evaluating the argument to fn.
+type frame struct {
+	arg    Term
+	argEnv *env
+	fn     value
+}
+
+// readback converts a term that is evaluated in e back into a term, by
+// substituting the values in e for its free variables. The term is placed
+// under depth abstractions, and local counts the abstractions within it.
+func readback(t Term, e *env, local, depth int) Term {
+	switch t := t.(type) {
+	case Var:
+		if int(t) < local {
+			return t
+		}
+		return e.lookup(int(t) - local).readback(local + depth)
+	case Abs:
+		return Abs{t.OldBind, readback(t.Body, e, local+1, depth)}
+	case App:
+		return App{readback(t.Fn, e, local, depth), readback(t.Arg, e, local, depth)}
+	}
+	panic("unreachable")
+}
+
+// readbackState converts a machine state back into the term it stands for,
+// so that evaluations that run out of budget report the term they reached.
+func readbackState(t Term, k []frame) Term {
+	for i := len(k) - 1; i >= 0; i-- {
+		if k[i].fn == nil {
+			t = App{t, readback(k[i].arg, k[i].argEnv, 0, 0)}
+		} else {
+			t = App{k[i].fn.readback(0), t}
+		}
+	}
+	return t
+}
+
+func framesEqual(k1, k2 []frame) bool {
+	if len(k1) != len(k2) {
+		return false
+	}
+	for i := range k1 {
+		if k1[i] != k2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// evalCEK evaluates a term in a context of depth free variables. An
+// application whose function, argument and continuation are the same as
+// those of the previous application is reported as a cycle.
+func evalCEK(t Term, depth int) (Term, error) {
+	b := newBudget()
+	var (
+		e         *env
+		v         value
+		k         []frame
+		lastFn    value
+		lastArg   value
+		lastFrame []frame
+	)
+	for i := depth - 1; i >= 0; i-- {
+		e = &env{&neutral{index: i}, e}
+	}
+	for {
+		if v == nil {
+			switch c := t.(type) {
+			case Var:
+				v = e.lookup(int(c))
+			case Abs:
+				v = &closure{c, e}
+			case App:
+				k = append(k, frame{arg: c.Arg, argEnv: e})
+				t = c.Fn
+			}
+			continue
+		}
+		if len(k) == 0 {
+			return v.readback(0), nil
+		}
+		f := k[len(k)-1]
+		k = k[:len(k)-1]
+		if f.fn == nil {
+			k = append(k, frame{fn: v})
+			t, e, v = f.arg, f.argEnv, nil
+			continue
+		}
+		fn, ok := f.fn.(*closure)
+		if !ok {
+			n := f.fn.(*neutral)
+			v = &neutral{n.index, append(slices.Clone(n.args), v)}
+			continue
+		}
+		if err := b.spend(); err != nil {
+			return readbackState(App{fn.readback(0), v.readback(0)}, k), err
+		}
+		if f.fn == lastFn && v == lastArg && framesEqual(k, lastFrame) {
+			return readbackState(App{fn.readback(0), v.readback(0)}, k), errCycle
+		}
+		lastFn, lastArg, lastFrame = f.fn, v, append(lastFrame[:0], k...)
+		t, e, v = fn.abs.Body, &env{v, fn.env}, nil
+	}
+}
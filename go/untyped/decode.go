@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// unthunk replaces the thunks in t with the terms they hold.
+func unthunk(t Term) Term {
+	switch t := t.(type) {
+	case Abs:
+		return Abs{t.OldBind, unthunk(t.Body)}
+	case App:
+		return App{unthunk(t.Fn), unthunk(t.Arg)}
+	case *Thunk:
+		return unthunk(t.T)
+	}
+	return t
+}
+
+// free reports whether t mentions a variable bound outside of it, at depth
+// c.
+func free(c int, t Term) bool {
+	switch t := t.(type) {
+	case Var:
+		return int(t) >= c
+	case Abs:
+		return free(c+1, t.Body)
+	case App:
+		return free(c, t.Fn) || free(c, t.Arg)
+	}
+	return false
+}
+
+// bound reports whether t mentions one of the d variables bound just
+// outside of it, at depth c.
+func bound(c, d int, t Term) bool {
+	switch t := t.(type) {
+	case Var:
+		return int(t) >= c && int(t) < c+d
+	case Abs:
+		return bound(c+1, d, t.Body)
+	case App:
+		return bound(c, d, t.Fn) || bound(c, d, t.Arg)
+	}
+	return false
+}
+
+// spine splits t into the function at the head of a sequence of
+// applications and its arguments.
+func spine(t Term) (Term, []Term) {
+	app, ok := t.(App)
+	if !ok {
+		return t, nil
+	}
+	fn, args := spine(app.Fn)
+	return fn, append(args, app.Arg)
+}
+
+// decode recognizes the Church encodings of TAPL §5.2 in a normal form. It
+// returns a description of t, such as "numeral 2", and the value itself,
+// such as "2". The terms λt. λf. f, λs. λz. z and λc. λn. n are the same up
+// to renaming, so they are described together.
+func decode(ctx []string, t Term) (desc, value string, ok bool) {
+	abs, ok := t.(Abs)
+	if !ok {
+		return "", "", false
+	}
+	switch body := abs.Body.(type) {
+	case Abs:
+		if body.Body == Var(1) {
+			return "boolean true", "true", true
+		}
+		if body.Body == Var(0) {
+			return "numeral 0, boolean false or empty list", "0", true
+		}
+		if n, ok := decodeNumeral(body.Body); ok {
+			return "numeral " + strconv.Itoa(n), strconv.Itoa(n), true
+		}
+		if elems, ok := decodeList(ctx, body.Body); ok {
+			value := "[" + strings.Join(elems, ", ") + "]"
+			return "list " + value, value, true
+		}
+	case App:
+		fn, args := spine(body)
+		if fn != Var(0) || len(args) != 2 || bound(0, 1, args[0]) || bound(0, 1, args[1]) {
+			return "", "", false
+		}
+		value := "(" + decodeElem(ctx, 1, args[0]) + ", " + decodeElem(ctx, 1, args[1]) + ")"
+		return "pair " + value, value, true
+	}
+	return "", "", false
+}
+
+// decodeNumeral recognizes the body s (s ... (s z)) of a Church numeral, in
+// which s is Var(1) and z is Var(0).
+func decodeNumeral(t Term) (int, bool) {
+	n := 0
+	for {
+		if t == Var(0) {
+			return n, n > 0
+		}
+		app, ok := t.(App)
+		if !ok || app.Fn != Var(1) {
+			return 0, false
+		}
+		t = app.Arg
+		n++
+	}
+}
+
+// decodeList recognizes the body c h1 (c h2 ... (c hn n)) of a Church list,
+// in which c is Var(1) and n is Var(0).
+func decodeList(ctx []string, t Term) ([]string, bool) {
+	var elems []string
+	for t != Var(0) {
+		fn, args := spine(t)
+		if fn != Var(1) || len(args) != 2 || bound(0, 2, args[0]) {
+			return nil, false
+		}
+		elems = append(elems, decodeElem(ctx, 2, args[0]))
+		t = args[1]
+	}
+	return elems, len(elems) > 0
+}
+
+// decodeElem decodes a component of a pair or list that appears under d
+// binders. Components that are not encodings are printed as terms.
+func decodeElem(ctx []string, d int, t Term) string {
+	t = shift(-d, 0, t)
+	if _, value, ok := decode(ctx, t); ok {
+		return value
+	}
+	return show(ctx, t)
+}
@@ -0,0 +1,43 @@
+package main
+
+// preludeSource defines the Church encodings of TAPL §5.2. It is loaded
+// before the input file when -prelude is given.
+const preludeSource = `
+tru = λt. λf. t;
+fls = λt. λf. f;
+test = λl. λm. λn. l m n;
+and = λb. λc. b c fls;
+or = λb. λc. b tru c;
+not = λb. b fls tru;
+
+pair = λf. λs. λb. b f s;
+fst = λp. p tru;
+snd = λp. p fls;
+
+c0 = λs. λz. z;
+c1 = λs. λz. s z;
+c2 = λs. λz. s (s z);
+c3 = λs. λz. s (s (s z));
+c4 = λs. λz. s (s (s (s z)));
+c5 = λs. λz. s (s (s (s (s z))));
+c6 = λs. λz. s (s (s (s (s (s z)))));
+c7 = λs. λz. s (s (s (s (s (s (s z))))));
+c8 = λs. λz. s (s (s (s (s (s (s (s z)))))));
+c9 = λs. λz. s (s (s (s (s (s (s (s (s z))))))));
+c10 = λs. λz. s (s (s (s (s (s (s (s (s (s z)))))))));
+scc = λn. λs. λz. s (n s z);
+plus = λm. λn. λs. λz. m s (n s z);
+times = λm. λn. m (plus n) c0;
+iszro = λm. m (λx. fls) tru;
+zz = pair c0 c0;
+ss = λp. pair (snd p) (plus c1 (snd p));
+prd = λm. fst (m ss zz);
+
+fix = λf. (λx. f (λy. x x y)) (λx. f (λy. x x y));
+
+nil = λc. λn. n;
+cons = λh. λt. λc. λn. c h (t c n);
+isnil = λl. l (λh. λt. fls) tru;
+head = λl. l (λh. λt. h) l;
+tail = λl. fst (l (λx. λp. pair (snd p) (cons x (snd p))) (pair nil nil));
+`
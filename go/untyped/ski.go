@@ -0,0 +1,222 @@
+package main
+
+import "fmt"
+
+// This file implements a further back end, which translates a term to S, K
+// and I combinators (and optionally B and C) by bracket abstraction, and
+// reduces the result on a combinator graph.
+
+// cterm is a term of combinatory logic, with variables still in it while
+// they are being abstracted. It is a cvar, a combinator or a capp.
+type cterm interface{}
+
+type cvar int
+
+type combinator byte
+
+type capp struct {
+	fn, arg cterm
+}
+
+// The lambda terms that each combinator stands for, in de Bruijn form.
+var combinators = map[combinator]Term{
+	'S': Abs{"x", Abs{"y", Abs{"z", App{App{Var(2), Var(0)}, App{Var(1), Var(0)}}}}},
+	'K': Abs{"x", Abs{"y", Var(1)}},
+	'I': Abs{"x", Var(0)},
+	'B': Abs{"x", Abs{"y", Abs{"z", App{Var(2), App{Var(1), Var(0)}}}}},
+	'C': Abs{"x", Abs{"y", Abs{"z", App{App{Var(2), Var(0)}, Var(1)}}}},
+}
+
+// arity is the number of arguments each combinator needs to be reduced.
+var arity = map[combinator]int{'S': 3, 'K': 2, 'I': 1, 'B': 3, 'C': 3}
+
+// occurs reports whether Var(i) occurs in c.
+func occurs(i int, c cterm) bool {
+	switch c := c.(type) {
+	case cvar:
+		return int(c) == i
+	case capp:
+		return occurs(i, c.fn) || occurs(i, c.arg)
+	}
+	return false
+}
+
+// down removes a binder that does not occur in c.
+func down(c cterm) cterm {
+	switch c := c.(type) {
+	case cvar:
+		return c - 1
+	case capp:
+		return capp{down(c.fn), down(c.arg)}
+	}
+	return c
+}
+
+// abstract eliminates Var(0) from c. If bc is set, applications in which
+// the variable only occurs on one side are abstracted with B and C instead
+// of S.
+func abstract(c cterm, bc bool) cterm {
+	if !occurs(0, c) {
+		return capp{combinator('K'), down(c)}
+	}
+	app, ok := c.(capp)
+	if !ok {
+		return combinator('I')
+	}
+	switch {
+	case bc && !occurs(0, app.fn):
+		return capp{capp{combinator('B'), down(app.fn)}, abstract(app.arg, bc)}
+	case bc && !occurs(0, app.arg):
+		return capp{capp{combinator('C'), abstract(app.fn, bc)}, down(app.arg)}
+	}
+	return capp{capp{combinator('S'), abstract(app.fn, bc)}, abstract(app.arg, bc)}
+}
+
+// translate translates t to combinators. The variables left in the result
+// are the free variables of t.
+func translate(t Term, bc bool) cterm {
+	switch t := t.(type) {
+	case Var:
+		return cvar(t)
+	case Abs:
+		return abstract(translate(t.Body, bc), bc)
+	case App:
+		return capp{translate(t.Fn, bc), translate(t.Arg, bc)}
+	}
+	panic("unreachable")
+}
+
+// node is a node of the combinator graph. It is an application if fn is
+// set, an indirection to ind if that is set, and otherwise a combinator or
+// a free variable.
+type node struct {
+	fn, arg *node
+	ind     *node
+	comb    combinator
+	free    int
+}
+
+func build(c cterm) *node {
+	switch c := c.(type) {
+	case cvar:
+		return &node{free: int(c)}
+	case combinator:
+		return &node{comb: c}
+	case capp:
+		return &node{fn: build(c.fn), arg: build(c.arg)}
+	}
+	panic("unreachable")
+}
+
+func (n *node) follow() *node {
+	for n.ind != nil {
+		n = n.ind
+	}
+	return n
+}
+
+// whnf reduces the graph at n to weak head normal form, in which the head
+// is a free variable or a combinator without enough arguments. Each
+// reduction overwrites the root of the redex with its result, so that
+// shared subgraphs are reduced at most once.
+func whnf(b *budget, n *node) error {
+	for {
+		var spine []*node
+		head := n.follow()
+		for head.fn != nil {
+			spine = append(spine, head)
+			head = head.fn.follow()
+		}
+		if head.comb == 0 || len(spine) < arity[head.comb] {
+			return nil
+		}
+		if err := b.spend(); err != nil {
+			return err
+		}
+		arg := func(i int) *node { return spine[len(spine)-1-i].arg }
+		root := spine[len(spine)-arity[head.comb]]
+		x := arg(0)
+		switch head.comb {
+		case 'I', 'K':
+			*root = node{ind: x}
+		case 'S':
+			*root = node{fn: &node{fn: x, arg: arg(2)}, arg: &node{fn: arg(1), arg: arg(2)}}
+		case 'B':
+			*root = node{fn: x, arg: &node{fn: arg(1), arg: arg(2)}}
+		case 'C':
+			*root = node{fn: &node{fn: x, arg: arg(2)}, arg: arg(1)}
+		}
+	}
+}
+
+// normalize reduces the graph at n to normal form, by reducing it to weak
+// head normal form and then normalizing the arguments on its spine.
+func normalize(b *budget, n *node) error {
+	if err := whnf(b, n); err != nil {
+		return err
+	}
+	for n = n.follow(); n.fn != nil; n = n.fn.follow() {
+		if err := normalize(b, n.arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readbackGraph converts the graph at n back into a term, replacing each
+// combinator with the abstraction it stands for.
+func readbackGraph(n *node) Term {
+	n = n.follow()
+	switch {
+	case n.fn != nil:
+		return App{readbackGraph(n.fn), readbackGraph(n.arg)}
+	case n.comb != 0:
+		return combinators[n.comb]
+	}
+	return Var(n.free)
+}
+
+// skiCheckSteps is the number of steps evalSKI may take to check its result
+// when -max-steps is not given.
+const skiCheckSteps = 100000
+
+// uncheckedError reports a result of evalSKI that could not be checked,
+// because evalBigStep did not finish within the budget.
+type uncheckedError struct {
+	err error
+}
+
+func (e uncheckedError) Error() string {
+	return "big-step check did not finish: " + e.err.Error()
+}
+
+// evalSKI translates t to combinators and reduces it to normal form. The
+// result is read back into a term, and returned in normal form.
+// It is checked to have the same normal form as the result of evalBigStep.
+// If the check does not finish, the result is returned with an
+// uncheckedError.
+func evalSKI(ctx []string, t Term) (Term, error) {
+	g := build(translate(t, *bc))
+	if err := normalize(newBudget(), g); err != nil {
+		return readbackGraph(g), err
+	}
+	nf, err := evalSmallStep(eval1Normal, readbackGraph(g))
+	if err != nil {
+		return nf, err
+	}
+	b := newBudget()
+	if b.maxSteps == 0 {
+		b.maxSteps = skiCheckSteps
+	}
+	v, err := evalBigStepBudget(b, t)
+	if err == nil {
+		v, err = evalSmallStepBudget(b, eval1Normal, v)
+	}
+	if err != nil {
+		return nf, uncheckedError{err}
+	}
+	if v.DeBruijnString() != nf.DeBruijnString() {
+		return nf, fmt.Errorf("combinators reduced to %s, but the big-step evaluator gives %s", show(ctx, nf), show(ctx, v))
+	}
+	return nf, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import "fmt"
+
+// strategies maps the names accepted by -strategy to single-step evaluators.
+var strategies = map[string]func(Term) (Term, error){
+	"full":   eval1Full,
+	"normal": eval1Normal,
+	"cbn":    eval1Name,
+	"cbv":    eval1,
+	"need":   eval1Need,
+}
+
+// eval1Full reduces the leftmost innermost redex, reducing under
+// abstractions. Full beta reduction allows any redex to be reduced, so this
+// is only one of its possible orders.
+func eval1Full(t Term) (Term, error) {
+	switch t := t.(type) {
+	case Abs:
+		body, err := eval1Full(t.Body)
+		if err != nil {
+			return nil, err
+		}
+		return Abs{t.OldBind, body}, nil
+	case App:
+		if t1Prime, err := eval1Full(t.Fn); err == nil {
+			return App{t1Prime, t.Arg}, nil
+		}
+		if t2Prime, err := eval1Full(t.Arg); err == nil {
+			return App{t.Fn, t2Prime}, nil
+		}
+		if abs, ok := t.Fn.(Abs); ok {
+			return substStop(t.Arg, abs.Body), nil
+		}
+	}
+	return nil, noRuleApplies
+}
+
+// eval1Normal reduces the leftmost outermost redex, reducing under
+// abstractions.
+func eval1Normal(t Term) (Term, error) {
+	switch t := t.(type) {
+	case Abs:
+		body, err := eval1Normal(t.Body)
+		if err != nil {
+			return nil, err
+		}
+		return Abs{t.OldBind, body}, nil
+	case App:
+		if abs, ok := t.Fn.(Abs); ok {
+			return substStop(t.Arg, abs.Body), nil
+		}
+		if t1Prime, err := eval1Normal(t.Fn); err == nil {
+			return App{t1Prime, t.Arg}, nil
+		}
+		if t2Prime, err := eval1Normal(t.Arg); err == nil {
+			return App{t.Fn, t2Prime}, nil
+		}
+	}
+	return nil, noRuleApplies
+}
+
+// eval1Name reduces the leftmost outermost redex, but not under
+// abstractions.
+func eval1Name(t Term) (Term, error) {
+	if t, ok := t.(App); ok {
+		if abs, ok := t.Fn.(Abs); ok {
+			return substStop(t.Arg, abs.Body), nil
+		}
+		t1Prime, err := eval1Name(t.Fn)
+		if err != nil {
+			return nil, err
+		}
+		return App{t1Prime, t.Arg}, nil
+	}
+	return nil, noRuleApplies
+}
+
+// Thunk is an argument that has been substituted without being evaluated.
+// Every occurrence of the argument shares the same Thunk, so it is evaluated
+// at most once. Only closed arguments are put in thunks, so shifting or
+// substituting into a Thunk leaves it unchanged. Arguments that mention
+// free variables are substituted as in call-by-name.
+type Thunk struct {
+	T Term
+}
+
+func (th *Thunk) DeBruijnString() string {
+	return th.T.DeBruijnString()
+}
+
+func (th *Thunk) ContextString(ctx []string) string {
+	return th.T.ContextString(ctx)
+}
+
+// force returns the value of t if t is a Thunk that has been evaluated.
+func force(t Term) Term {
+	if th, ok := t.(*Thunk); ok && isVal(th.T) {
+		return th.T
+	}
+	return t
+}
+
+// eval1Need is call-by-name with sharing: a redex substitutes its argument
+// as a Thunk, which is updated in place when it is evaluated.
+func eval1Need(t Term) (Term, error) {
+	switch t := t.(type) {
+	case *Thunk:
+		if isVal(t.T) {
+			return nil, noRuleApplies
+		}
+		tPrime, err := eval1Need(t.T)
+		if err != nil {
+			return nil, err
+		}
+		t.T = tPrime
+		return t, nil
+	case App:
+		if abs, ok := force(t.Fn).(Abs); ok {
+			arg := force(t.Arg)
+			if _, ok := arg.(*Thunk); !ok && !isVal(arg) && !free(0, arg) {
+				arg = &Thunk{arg}
+			}
+			return substStop(arg, abs.Body), nil
+		}
+		t1Prime, err := eval1Need(t.Fn)
+		if err != nil {
+			return nil, err
+		}
+		return App{t1Prime, t.Arg}, nil
+	}
+	return nil, noRuleApplies
+}
+
+func strategy(name string) func(Term) (Term, error) {
+	eval1, ok := strategies[name]
+	if !ok {
+		errExit(fmt.Errorf("unknown strategy %q", name))
+	}
+	return eval1
+}
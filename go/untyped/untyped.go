@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/samber/lo"
 	"golang.org/x/exp/slices"
@@ -14,10 +15,20 @@ import (
 var (
 	smallStep = flag.Bool("small-step", false, "run small-step evaluator")
 	bigStep   = flag.Bool("big-step", false, "run small-step evaluator")
+	cek       = flag.Bool("cek", false, "run CEK machine")
+	ski       = flag.Bool("ski", false, "translate to combinators and run the combinator graph reducer")
+	bc        = flag.Bool("bc", false, "use the B and C combinators in the translation to combinators")
+	strat     = flag.String("strategy", "cbv", "reduction strategy for the small-step evaluator: full, normal, cbn, cbv or need")
+	maxSteps  = flag.Int("max-steps", 0, "stop evaluation after `n` reduction steps (0 means no limit)")
+	timeout   = flag.Duration("timeout", 0, "stop evaluation after this long (0 means no limit)")
+	decodeOut = flag.Bool("decode", false, "normalize results and decode Church booleans, numerals, pairs and lists")
+	input     = flag.String("input", "named", "syntax of the input: named or debruijn")
+	output    = flag.String("output", "named", "syntax of the output: named or debruijn")
+	prelude   = flag.Bool("prelude", false, "load the Church encodings in the prelude")
 )
 
 func usage() {
-	fmt.Fprint(os.Stderr, "usage: unypted ( -small-step | -big-step ) file\n\n")
+	fmt.Fprint(os.Stderr, "usage: unypted ( -small-step [ -strategy name ] | -big-step | -cek | -ski [ -bc ] ) [ -max-steps n ] [ -timeout d ] [ -input syntax ] [ -output syntax ] [ -prelude ] [ -decode ] file\n\n")
 	fmt.Fprint(os.Stderr, "untyped is an implementation of the untyped lambda calculus (TAPL chapters 5-7).\n")
 	os.Exit(2)
 }
@@ -33,18 +44,58 @@ func unexpected(s string) {
 
 func validateToken(s string) {
 	switch s {
-	case "(", ")", "λ", ".":
+	case "(", ")", "λ", ".", "=", "==", ";", "/":
 	default:
-		if strings.IndexFunc(s, func(r rune) bool { return r < 'A' || r > 'z' }) >= 0 {
+		if !isIdent(s) && (!nameless || !isIndex(s)) {
 			unexpected(s)
 		}
 	}
 }
 
+func isLetter(r rune) bool {
+	return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r == '_'
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// isIdent reports whether s is an identifier: a letter or underscore
+// followed by letters, digits, underscores and primes.
+func isIdent(s string) bool {
+	for i, r := range s {
+		if !isLetter(r) && (i == 0 || !isDigit(r) && r != '\'') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// nameless is set when the input is in de Bruijn syntax. The prelude is
+// always named, so it is set after the prelude is loaded.
+var nameless bool
+
+func isIndex(s string) bool {
+	return s != "" && strings.IndexFunc(s, func(r rune) bool { return !isDigit(r) }) < 0
+}
+
+// scan splits s into tokens. Comments start with -- and run to the end of the
+// line. The lambda may also be written \ or lambda.
 func scan(s string) (res []string) {
-	res = strings.Fields(s)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i], _, _ = strings.Cut(line, "--")
+	}
+	res = strings.Fields(strings.Join(lines, "\n"))
+	// Tokens that are already separators are not split again, so that ==
+	// is not split into two = tokens.
+	var seps []string
 	sep := func(c string) []string {
+		seps = append(seps, c)
 		return lo.FlatMap(res, func(s string, _ int) (ret []string) {
+			if slices.Contains(seps, s) {
+				return []string{s}
+			}
 			for {
 				before, after, found := strings.Cut(s, c)
 				if before != "" {
@@ -63,8 +114,16 @@ func scan(s string) (res []string) {
 	res = sep(")")
 	res = sep(".")
 	res = sep("λ")
-	for _, s := range res {
-		validateToken(s)
+	res = sep("\\")
+	res = sep("==")
+	res = sep("=")
+	res = sep(";")
+	res = sep("/")
+	for i, s := range res {
+		if s == "\\" || s == "lambda" {
+			res[i] = "λ"
+		}
+		validateToken(res[i])
 	}
 	return res
 }
@@ -133,7 +192,14 @@ func expect(tok string, tokens []string) []string {
 	return tl
 }
 
+// parseLambda parses an abstraction after the λ. In nameless input, the
+// abstraction binds no name, so it is given a conventional one for printing.
 func parseLambda(ctx, tokens []string) (Term, []string) {
+	if nameless {
+		tokens = expect(".", tokens)
+		body, tokens := parse(prepend("", ctx), tokens)
+		return Abs{"x", body}, tokens
+	}
 	if len(tokens) == 0 {
 		errExit(fmt.Errorf("expected identifier, got \"EOF\""))
 	}
@@ -157,27 +223,123 @@ func parseSingle(ctx, tokens []string) (Term, []string) {
 	}
 	tok, tokens := tokens[0], tokens[1:]
 	switch tok {
-	case ")", ".":
+	case ")", ".", "=", "==", ";", "/":
 		unexpected(tok)
 	case "(":
 		return parseParenExpr(ctx, tokens)
 	case "λ":
 		return parseLambda(ctx, tokens)
 	}
+	if isIndex(tok) {
+		i, err := strconv.Atoi(tok)
+		if err != nil || i >= len(ctx) {
+			errExit(fmt.Errorf("index %s is out of range", tok))
+		}
+		return Var(i), tokens
+	}
 	i := slices.Index(ctx, tok)
+	// A definition hides a free variable of the same name declared before
+	// it, which was declared when topCtx had len(ctx)-i names.
+	if d, ok := defs[tok]; ok && (i < 0 || i >= len(ctx)-len(topCtx) && d.depth >= len(ctx)-i) {
+		return shift(len(ctx)-d.depth, 0, d.t), tokens
+	}
 	if i < 0 {
 		errExit(fmt.Errorf("undefined variable %q", tok))
 	}
 	return Var(i), tokens
 }
 
+// parse parses a sequence of terms as an application that associates to the
+// left, so that f x y is read as (f x) y.
 func parse(ctx, tokens []string) (Term, []string) {
-	a, tokens := parseSingle(ctx, tokens)
-	if len(tokens) == 0 || tokens[0] == ")" {
-		return a, tokens
+	t, tokens := parseSingle(ctx, tokens)
+	for len(tokens) > 0 && !slices.Contains([]string{")", ";", "=="}, tokens[0]) {
+		var arg Term
+		arg, tokens = parseSingle(ctx, tokens)
+		t = App{t, arg}
+	}
+	return t, tokens
+}
+
+// topCtx names the free variables declared with name/, most recent first.
+var topCtx []string
+
+// def is the term bound by a top-level definition. The term may refer to
+// the first depth names in topCtx, so it is shifted by the number of names
+// declared since wherever the name is used.
+type def struct {
+	t     Term
+	depth int
+}
+
+var defs = make(map[string]def)
+
+// isAssertion reports whether the statement at the start of tokens, which
+// starts with assert, is an assertion. Since assert may also be declared or
+// defined as a name, a statement that uses it as such is told apart by not
+// having == before the next ;.
+func isAssertion(tokens []string) bool {
+	_, defined := defs["assert"]
+	if !defined && !slices.Contains(topCtx, "assert") {
+		return true
+	}
+	for _, tok := range tokens {
+		switch tok {
+		case "==":
+			return true
+		case ";":
+			return false
+		}
+	}
+	return false
+}
+
+// A statement is a term to evaluate, or an assertion assert t == rhs. The
+// terms are in the context ctx.
+type statement struct {
+	t   Term
+	rhs Term
+	ctx []string
+}
+
+// parseFile parses a sequence of statements separated by semicolons, where a
+// statement is a definition name = term, a free variable declaration name/,
+// an assertion assert term == term, or a term to evaluate. It returns the
+// statements other than definitions and declarations.
+func parseFile(tokens []string) (stmts []statement) {
+	for len(tokens) > 0 {
+		if len(tokens) > 1 && (tokens[1] == "=" || tokens[1] == "/") {
+			name := tokens[0]
+			if !isIdent(name) {
+				unexpected(name)
+			}
+			if tokens[1] == "/" {
+				topCtx = prepend(name, topCtx)
+				tokens = tokens[2:]
+			} else {
+				var t Term
+				t, tokens = parse(topCtx, tokens[2:])
+				defs[name] = def{t, len(topCtx)}
+			}
+		} else if tokens[0] == "assert" && isAssertion(tokens) {
+			var lhs, rhs Term
+			lhs, tokens = parse(topCtx, tokens[1:])
+			rhs, tokens = parse(topCtx, expect("==", tokens))
+			stmts = append(stmts, statement{lhs, rhs, topCtx})
+		} else {
+			var t Term
+			t, tokens = parse(topCtx, tokens)
+			stmts = append(stmts, statement{t: t, ctx: topCtx})
+		}
+		if len(tokens) == 0 {
+			break
+		}
+		if tokens[0] != ";" {
+			errExit(fmt.Errorf("expected token \"EOF\", got %q", tokens[0]))
+		}
+		tokens = tokens[1:]
 	}
-	b, tokens := parseSingle(ctx, tokens)
-	return App{a, b}, tokens
+	return stmts
 }
 
 var noRuleApplies = fmt.Errorf("no rule applies")
@@ -194,6 +356,12 @@ func eval1(t Term) (Term, error) {
 				return nil, err
 			}
 			return App{abs, t2Prime}, nil
+		} else if isVal(t.Fn) {
+			t2Prime, err := eval1(t.Arg)
+			if err != nil {
+				return nil, err
+			}
+			return App{t.Fn, t2Prime}, nil
 		} else {
 			t1Prime, err := eval1(t.Fn)
 			if err != nil {
@@ -206,17 +374,83 @@ func eval1(t Term) (Term, error) {
 	}
 }
 
-func evalSmallStep(t Term) Term {
-	t1Prime, err := eval1(t)
-	if err != nil {
-		return t
+// budget limits the number of reduction steps and the time taken by an
+// evaluation.
+type budget struct {
+	steps    int
+	maxSteps int
+	deadline time.Time
+}
+
+func newBudget() *budget {
+	b := &budget{maxSteps: *maxSteps}
+	if *timeout > 0 {
+		b.deadline = time.Now().Add(*timeout)
+	}
+	return b
+}
+
+// spend is called before each reduction step, and fails if the budget has
+// run out.
+func (b *budget) spend() error {
+	if b.exhausted() {
+		return fmt.Errorf("evaluation did not terminate within %d steps", b.maxSteps)
 	}
-	return evalSmallStep(t1Prime)
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return fmt.Errorf("evaluation did not terminate within %v", *timeout)
+	}
+	b.steps++
+	return nil
+}
+
+func (b *budget) exhausted() bool {
+	return b.maxSteps > 0 && b.steps == b.maxSteps
 }
 
-func isVal(t Term) (isAbs bool) {
-	_, isAbs = t.(Abs)
-	return
+var errCycle = fmt.Errorf("evaluation does not terminate: the term reduces to itself")
+
+// evalSmallStep returns the term reached when no rule applies, or the term
+// reached so far along with an error if evaluation would not terminate. A
+// term that reduces to itself, up to renaming of bound variables, is
+// reported as a cycle.
+func evalSmallStep(eval1 func(Term) (Term, error), t Term) (Term, error) {
+	return evalSmallStepBudget(newBudget(), eval1, t)
+}
+
+func evalSmallStepBudget(b *budget, eval1 func(Term) (Term, error), t Term) (Term, error) {
+	prev := t.DeBruijnString()
+	for {
+		t1Prime, err := eval1(t)
+		if err != nil {
+			return t, nil
+		}
+		if err := b.spend(); err != nil {
+			return t, err
+		}
+		t = t1Prime
+		next := t.DeBruijnString()
+		if next == prev {
+			return t, errCycle
+		}
+		prev = next
+	}
+}
+
+// isVal reports whether t is an abstraction or a neutral term: a free
+// variable applied to values, which is stuck.
+func isVal(t Term) bool {
+	switch t := t.(type) {
+	case Abs, Var:
+		return true
+	case App:
+		return isNeutral(t.Fn) && isVal(t.Arg)
+	}
+	return false
+}
+
+func isNeutral(t Term) bool {
+	_, isAbs := t.(Abs)
+	return !isAbs && isVal(t)
 }
 
 func shift(d, c int, t Term) Term {
@@ -230,6 +464,8 @@ func shift(d, c int, t Term) Term {
 		return Abs{t.OldBind, shift(d, c+1, t.Body)}
 	case App:
 		return App{shift(d, c, t.Fn), shift(d, c, t.Arg)}
+	case *Thunk:
+		return t
 	}
 	panic("unreachable")
 }
@@ -245,6 +481,8 @@ func subst(j int, s, t Term) Term {
 		return Abs{t.OldBind, subst(j+1, shift(1, 0, s), t.Body)}
 	case App:
 		return App{subst(j, s, t.Fn), subst(j, s, t.Arg)}
+	case *Thunk:
+		return t
 	}
 	panic("unreachable")
 }
@@ -253,31 +491,126 @@ func substStop(s, t Term) Term {
 	return shift(-1, 0, subst(0, shift(1, 0, s), t))
 }
 
-func evalBigStep(t Term) Term {
-	switch t := t.(type) {
-	case App:
-		v1 := evalBigStep(t.Fn)
-		switch v1 := v1.(type) {
-		case Abs:
-			v2 := evalBigStep(t.Arg)
-			if isVal(v2) {
-				return evalBigStep(substStop(v2, v1.Body))
-			}
-			return t
-		default:
-			return t
+// evalBigStep is like evalSmallStep, but when evaluation would not
+// terminate, the term it returns is rebuilt from the evaluations that were
+// in progress.
+func evalBigStep(t Term) (Term, error) {
+	return evalBigStepBudget(newBudget(), t)
+}
+
+func evalBigStepBudget(b *budget, t Term) (Term, error) {
+	for {
+		app, ok := t.(App)
+		if !ok {
+			return t, nil
 		}
-	default:
-		return t
+		v1, err := evalBigStepBudget(b, app.Fn)
+		if err != nil {
+			return App{v1, app.Arg}, err
+		}
+		if !isVal(v1) {
+			return t, nil
+		}
+		v2, err := evalBigStepBudget(b, app.Arg)
+		if err != nil {
+			return App{v1, v2}, err
+		}
+		if !isVal(v2) {
+			return t, nil
+		}
+		abs, ok := v1.(Abs)
+		if !ok {
+			return App{v1, v2}, nil
+		}
+		redex := App{abs, v2}
+		if err := b.spend(); err != nil {
+			return redex, err
+		}
+		t = substStop(v2, abs.Body)
+		if t.DeBruijnString() == redex.DeBruijnString() {
+			return t, errCycle
+		}
+	}
+}
+
+// show prints t, which is in the context ctx, in the syntax selected by
+// -output.
+func show(ctx []string, t Term) string {
+	if *output == "debruijn" {
+		return t.DeBruijnString()
+	}
+	return t.ContextString(ctx)
+}
+
+// assertionSteps is the number of steps an assertion may take to normalize
+// both of its sides when -max-steps is not given.
+const assertionSteps = 1000
+
+// undecided reports an assertion whose sides could not be normalized within
+// the budget.
+func undecided(b *budget, err error) error {
+	if b.exhausted() {
+		return fmt.Errorf("undecided within %d steps", b.maxSteps)
+	}
+	return err
+}
+
+// checkAssertion checks that t1 and t2 are equivalent: either the same up to
+// renaming of bound variables, or with the same normal form
+// within the budget.
+func checkAssertion(ctx []string, t1, t2 Term) error {
+	if t1.DeBruijnString() == t2.DeBruijnString() {
+		return nil
+	}
+	b := newBudget()
+	if b.maxSteps == 0 {
+		b.maxSteps = assertionSteps
+	}
+	nf1, err := evalSmallStepBudget(b, eval1Normal, t1)
+	if err != nil {
+		return undecided(b, err)
+	}
+	nf2, err := evalSmallStepBudget(b, eval1Normal, t2)
+	if err != nil {
+		return undecided(b, err)
+	}
+	if nf1.DeBruijnString() != nf2.DeBruijnString() {
+		return fmt.Errorf("the normal forms differ\n\t%s\n\t%s", show(ctx, nf1), show(ctx, nf2))
+	}
+	return nil
+}
+
+// printDecoded prints the normal form of t, followed by the value it
+// encodes if it is recognized. If t has no normal form within the budget, t
+// is printed as is.
+func printDecoded(ctx []string, t Term) {
+	nf, err := evalSmallStep(eval1Normal, unthunk(t))
+	if err != nil {
+		fmt.Println(show(ctx, t))
+		return
+	}
+	if desc, _, ok := decode(ctx, nf); ok {
+		fmt.Printf("%s -- church %s\n", show(ctx, nf), desc)
+	} else {
+		fmt.Println(show(ctx, nf))
 	}
 }
 
 func main() {
 	flag.Usage = usage
 	flag.Parse()
-	if *smallStep == *bigStep {
+	if lo.Count([]bool{*smallStep, *bigStep, *cek, *ski}, true) != 1 {
 		usage()
 	}
+	if !*smallStep && *strat != "cbv" {
+		errExit(fmt.Errorf("only the small-step evaluator supports strategies other than cbv"))
+	}
+	eval1 := strategy(*strat)
+	for _, syntax := range []string{*input, *output} {
+		if syntax != "named" && syntax != "debruijn" {
+			errExit(fmt.Errorf("unknown syntax %q", syntax))
+		}
+	}
 	args := flag.Args()
 	if len(args) != 1 {
 		usage()
@@ -287,15 +620,50 @@ func main() {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		usage()
 	}
-	tokens := scan(string(b))
-	ast, tokens := parse(nil, tokens)
-	if len(tokens) != 0 {
-		errExit(fmt.Errorf("expected token \"EOF\", got %q", tokens[0]))
+	if *prelude {
+		parseFile(scan(preludeSource))
 	}
-	if *smallStep {
-		ast = evalSmallStep(ast)
-	} else {
-		ast = evalBigStep(ast)
+	nameless = *input == "debruijn"
+	failed := false
+	n := 0
+	for _, stmt := range parseFile(scan(string(b))) {
+		t := stmt.t
+		if stmt.rhs != nil {
+			n++
+			if err := checkAssertion(stmt.ctx, t, stmt.rhs); err != nil {
+				fmt.Fprintf(os.Stderr, "assertion %d failed: %v\n", n, err)
+				failed = true
+			}
+			continue
+		}
+		switch {
+		case *smallStep:
+			t, err = evalSmallStep(eval1, t)
+		case *bigStep:
+			t, err = evalBigStep(t)
+		case *cek:
+			t, err = evalCEK(t, len(stmt.ctx))
+		case *ski:
+			t, err = evalSKI(stmt.ctx, t)
+		}
+		var unchecked error
+		if _, ok := err.(uncheckedError); ok {
+			unchecked, err = err, nil
+		}
+		if err != nil {
+			fmt.Println(show(stmt.ctx, t))
+			errExit(err)
+		}
+		if *decodeOut {
+			printDecoded(stmt.ctx, t)
+		} else {
+			fmt.Println(show(stmt.ctx, t))
+		}
+		if unchecked != nil {
+			fmt.Fprintln(os.Stderr, unchecked)
+		}
+	}
+	if failed {
+		os.Exit(1)
 	}
-	fmt.Println(ast.ContextString(nil))
 }
@@ -18,19 +18,43 @@ var (
 	}()
 	projectRoot = filepath.Dir(filepath.Dir(testPath))
 	testDir     = os.DirFS(testPath)
-	inOut       = func() map[string]string {
-		m := make(map[string]string)
-		panicErr(fs.WalkDir(testDir, ".", func(path string, d fs.DirEntry, err error) error {
-			parts := strings.Split(path, ".")
-			if len(parts) == 3 && parts[1] == "in" {
-				m[filepath.Join(testPath, path)] = strings.Join([]string{parts[0], "out.txt"}, ".")
-			}
-			return err
-		}))
-		return m
-	}()
+	inOut       = cases(".")
 )
 
+// cases collects the test cases in dir. Subdirectories hold tests for
+// features that only some implementations support, so they are skipped.
+func cases(dir string) map[string]string {
+	m := make(map[string]string)
+	panicErr(fs.WalkDir(testDir, dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != dir {
+			return fs.SkipDir
+		}
+		parts := strings.Split(path, ".")
+		if len(parts) == 3 && parts[1] == "in" {
+			m[filepath.Join(testPath, path)] = strings.Join([]string{parts[0], "out.txt"}, ".")
+		}
+		return nil
+	}))
+	return m
+}
+
+// override returns a copy of inOut in which an expected output is read from
+// dir instead, if dir has a file of the same name. It is used for diagnostics
+// whose format differs between implementations.
+func override(inOut map[string]string, dir string) map[string]string {
+	m := make(map[string]string)
+	for in, out := range inOut {
+		m[in] = out
+		if _, err := fs.Stat(testDir, filepath.Join(dir, out)); err == nil {
+			m[in] = filepath.Join(dir, out)
+		}
+	}
+	return m
+}
+
 func panicErr(err error) {
 	if err != nil {
 		panic(err)
@@ -38,12 +62,19 @@ func panicErr(err error) {
 }
 
 func test(name string, args ...string) func(t *testing.T) {
+	return testCases(inOut, name, args...)
+}
+
+func testCases(inOut map[string]string, name string, args ...string) func(t *testing.T) {
 	return func(t *testing.T) {
 		for in, out := range inOut {
 			got, err := exec.Command(name, append(args, in)...).CombinedOutput()
 			if _, ok := err.(*exec.ExitError); !ok && err != nil {
 				t.Fatal(err)
 			}
+			// Diagnostics name the input file, so make them independent
+			// of where the tests are run from.
+			got = bytes.ReplaceAll(got, []byte(testPath+string(filepath.Separator)), nil)
 			want, err := fs.ReadFile(testDir, out)
 			if err != nil {
 				t.Fatal(err)
@@ -70,8 +101,34 @@ func TestGo(t *testing.T) {
 	if err := run("go", "build"); err != nil {
 		t.Fatal(err)
 	}
-	t.Run("SmallStep", test("./arith", "-small-step"))
-	t.Run("BigStep", test("./arith", "-big-step"))
+	t.Run("SmallStep", testCases(override(inOut, "go"), "./arith", "-small-step"))
+	t.Run("BigStep", testCases(override(inOut, "go"), "./arith", "-big-step"))
+	t.Run("VM", testCases(override(inOut, "go"), "./arith", "-vm"))
+	t.Run("Disassemble", testCases(cases("vm"), "./arith", "-numeric", "-vm", "-disasm"))
+	t.Run("Graph", testCases(cases("graph"), "./arith", "-numeric", "-graph"))
+	t.Run("SyntaxSmallStep", testCases(cases("syntax"), "./arith", "-small-step"))
+	t.Run("SyntaxBigStep", testCases(cases("syntax"), "./arith", "-big-step"))
+	t.Run("Numeric", testCases(cases("numeric"), "./arith", "-numeric", "-small-step"))
+	t.Run("PrimsSmallStep", testCases(cases("prims"), "./arith", "-numeric", "-strict", "-small-step"))
+	t.Run("PrimsBigStep", testCases(cases("prims"), "./arith", "-numeric", "-strict", "-big-step"))
+	t.Run("Positions", testCases(cases("positions"), "./arith", "-strict", "-small-step"))
+	t.Run("Tree", testCases(cases("tree"), "./arith", "-small-step"))
+	t.Run("TypeCheck", testCases(cases("typecheck"), "./arith", "-typecheck"))
+	t.Run("StrictSmallStep", testCases(cases("strict"), "./arith", "-strict", "-small-step"))
+	t.Run("StrictBigStep", testCases(cases("strict"), "./arith", "-strict", "-big-step"))
+	t.Run("StrictVM", testCases(cases("strict"), "./arith", "-strict", "-vm"))
+	t.Run("StuckBigStep", testCases(cases("vm/stuck"), "./arith", "-big-step"))
+	t.Run("StuckVM", testCases(cases("vm/stuck"), "./arith", "-vm"))
+	t.Run("Trace", testCases(cases("trace"), "./arith", "-trace", "-small-step"))
+	t.Run("Derivation", testCases(cases("derivation"), "./arith", "-derivation", "text"))
+	t.Run("DerivationLaTeX", testCases(cases("derivation-latex"), "./arith", "-derivation", "latex"))
+	t.Run("Wrong", testCases(cases("wrong"), "./arith", "-wrong"))
+	t.Run("CompareWrong", testCases(cases("compare-wrong"), "./arith", "-compare-wrong"))
+	t.Run("Check", func(t *testing.T) {
+		if out, err := exec.Command("./arith", "-check", "3").CombinedOutput(); err != nil {
+			t.Errorf("%v:\n%s", err, out)
+		}
+	})
 }
 
 func TestSML(t *testing.T) {
@@ -0,0 +1,106 @@
+package fulluntyped_test
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	testPath = func() string {
+		cwd, err := os.Getwd()
+		panicErr(err)
+		return cwd
+	}()
+	projectRoot = filepath.Dir(filepath.Dir(testPath))
+	testDir     = os.DirFS(testPath)
+	inOut       = cases(".")
+)
+
+// cases collects the test cases in dir, but not in its subdirectories.
+func cases(dir string) map[string]string {
+	m := make(map[string]string)
+	panicErr(fs.WalkDir(testDir, dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != dir {
+			return fs.SkipDir
+		}
+		parts := strings.Split(path, ".")
+		if len(parts) == 3 && parts[1] == "in" {
+			m[filepath.Join(testPath, path)] = strings.Join([]string{parts[0], "out.txt"}, ".")
+		}
+		return nil
+	}))
+	return m
+}
+
+// override returns a copy of inOut in which an expected output is read from
+// dir instead, if dir has a file of the same name. The big-step evaluator
+// leaves stuck terms unevaluated, so its stuck outputs are overridden.
+func override(inOut map[string]string, dir string) map[string]string {
+	m := make(map[string]string)
+	for in, out := range inOut {
+		m[in] = out
+		if _, err := fs.Stat(testDir, filepath.Join(dir, out)); err == nil {
+			m[in] = filepath.Join(dir, out)
+		}
+	}
+	return m
+}
+
+func panicErr(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func test(name string, args ...string) func(t *testing.T) {
+	return testCases(inOut, name, args...)
+}
+
+func testCases(inOut map[string]string, name string, args ...string) func(t *testing.T) {
+	return func(t *testing.T) {
+		for in, out := range inOut {
+			got, err := exec.Command(name, append(args, in)...).CombinedOutput()
+			if _, ok := err.(*exec.ExitError); !ok && err != nil {
+				t.Fatal(err)
+			}
+			want, err := fs.ReadFile(testDir, out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Compare(got, want) != 0 {
+				t.Errorf("%s does not match output:\n`%s`", out, got)
+			}
+		}
+	}
+}
+
+func run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func TestGo(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("could not find 'go' executable in PATH")
+	}
+	goDir := filepath.Join(projectRoot, "go", "fulluntyped")
+	os.Chdir(goDir)
+	if err := run("go", "build"); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("SmallStep", test("./fulluntyped", "-small-step"))
+	t.Run("BigStep", test("./fulluntyped", "-big-step"))
+	t.Run("StuckSmallStep", testCases(cases("stuck"), "./fulluntyped", "-small-step"))
+	t.Run("StuckBigStep", testCases(override(cases("stuck"), "big-step"), "./fulluntyped", "-big-step"))
+	t.Run("SyntaxSmallStep", testCases(cases("syntax"), "./fulluntyped", "-small-step"))
+	t.Run("SyntaxBigStep", testCases(cases("syntax"), "./fulluntyped", "-big-step"))
+}
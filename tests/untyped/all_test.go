@@ -18,19 +18,42 @@ var (
 	}()
 	projectRoot = filepath.Dir(filepath.Dir(testPath))
 	testDir     = os.DirFS(testPath)
-	inOut       = func() map[string]string {
-		m := make(map[string]string)
-		panicErr(fs.WalkDir(testDir, ".", func(path string, d fs.DirEntry, err error) error {
-			parts := strings.Split(path, ".")
-			if len(parts) == 3 && parts[1] == "in" {
-				m[filepath.Join(testPath, path)] = strings.Join([]string{parts[0], "out.txt"}, ".")
-			}
-			return err
-		}))
-		return m
-	}()
+	inOut       = cases(".")
 )
 
+// cases collects the test cases in dir. Subdirectories hold tests for
+// features that only some implementations support, so they are skipped.
+func cases(dir string) map[string]string {
+	m := make(map[string]string)
+	panicErr(fs.WalkDir(testDir, dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != dir {
+			return fs.SkipDir
+		}
+		parts := strings.Split(path, ".")
+		if len(parts) == 3 && parts[1] == "in" {
+			m[filepath.Join(testPath, path)] = strings.Join([]string{parts[0], "out.txt"}, ".")
+		}
+		return nil
+	}))
+	return m
+}
+
+// override returns a copy of inOut in which an expected output is read from
+// dir instead, if dir has a file of the same name.
+func override(inOut map[string]string, dir string) map[string]string {
+	m := make(map[string]string)
+	for in, out := range inOut {
+		m[in] = out
+		if _, err := fs.Stat(testDir, filepath.Join(dir, out)); err == nil {
+			m[in] = filepath.Join(dir, out)
+		}
+	}
+	return m
+}
+
 func panicErr(err error) {
 	if err != nil {
 		panic(err)
@@ -38,6 +61,10 @@ func panicErr(err error) {
 }
 
 func test(name string, args ...string) func(t *testing.T) {
+	return testCases(inOut, name, args...)
+}
+
+func testCases(inOut map[string]string, name string, args ...string) func(t *testing.T) {
 	return func(t *testing.T) {
 		for in, out := range inOut {
 			got, err := exec.Command(name, append(args, in)...).CombinedOutput()
@@ -55,6 +82,25 @@ func test(name string, args ...string) func(t *testing.T) {
 	}
 }
 
+// roundTrip checks that the values printed in syntax are read back as the
+// same terms.
+func roundTrip(inOut map[string]string, syntax string) func(t *testing.T) {
+	return func(t *testing.T) {
+		for in := range inOut {
+			want, err := exec.Command("./untyped", "-output="+syntax, "-small-step", in).Output()
+			if err != nil {
+				continue
+			}
+			printed := filepath.Join(t.TempDir(), "printed.txt")
+			panicErr(os.WriteFile(printed, want, 0o666))
+			got, err := exec.Command("./untyped", "-input="+syntax, "-output="+syntax, "-small-step", printed).CombinedOutput()
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("%s: %v: reading back %s gave %s", in, err, want, got)
+			}
+		}
+	}
+}
+
 func run(name string, args ...string) error {
 	cmd := exec.Command(name, args...)
 	cmd.Stderr = os.Stderr
@@ -72,8 +118,71 @@ func TestGo(t *testing.T) {
 	}
 	t.Run("SmallStep", test("./untyped", "-small-step"))
 	t.Run("BigStep", test("./untyped", "-big-step"))
+	t.Run("ApplicationSmallStep", testCases(cases("application"), "./untyped", "-small-step"))
+	t.Run("ApplicationBigStep", testCases(cases("application"), "./untyped", "-big-step"))
+	t.Run("DefsSmallStep", testCases(cases("defs"), "./untyped", "-small-step"))
+	t.Run("DefsBigStep", testCases(cases("defs"), "./untyped", "-big-step"))
+	t.Run("PreludeSmallStep", testCases(cases("prelude"), "./untyped", "-prelude", "-small-step"))
+	t.Run("PreludeBigStep", testCases(cases("prelude"), "./untyped", "-prelude", "-big-step"))
+	t.Run("CallByValue", test("./untyped", "-strategy=cbv", "-small-step"))
+	for _, strategy := range []string{"full", "normal", "cbn", "need"} {
+		t.Run("Strategy/"+strategy, testCases(cases(strategy), "./untyped", "-prelude", "-strategy="+strategy, "-small-step"))
+	}
+	t.Run("DivergeSmallStep", testCases(cases("diverge"), "./untyped", "-max-steps=20", "-small-step"))
+	t.Run("DivergeBigStep", testCases(cases("diverge"), "./untyped", "-max-steps=20", "-big-step"))
+	t.Run("Decode", testCases(cases("decode"), "./untyped", "-prelude", "-decode", "-max-steps=10000", "-small-step"))
+	t.Run("DecodeNeed", testCases(cases("decode"), "./untyped", "-prelude", "-decode", "-max-steps=10000", "-strategy=need", "-small-step"))
+	t.Run("Assert", testCases(cases("assert"), "./untyped", "-prelude", "-max-steps=1000", "-small-step"))
+	t.Run("AssertDefaultBudget", testCases(cases("assert/budget"), "./untyped", "-prelude", "-small-step"))
+	t.Run("CEK", test("./untyped", "-cek"))
+	t.Run("ApplicationCEK", testCases(cases("application"), "./untyped", "-cek"))
+	t.Run("DefsCEK", testCases(cases("defs"), "./untyped", "-cek"))
+	t.Run("PreludeCEK", testCases(cases("prelude"), "./untyped", "-prelude", "-cek"))
+	t.Run("DivergeCEK", testCases(cases("diverge"), "./untyped", "-max-steps=20", "-cek"))
+	for _, mode := range []string{"small-step", "big-step", "cek"} {
+		t.Run("ExactBudget/"+mode, testCases(cases("budget"), "./untyped", "-max-steps=2", "-"+mode))
+	}
+	t.Run("ArithmeticBigStep", testCases(cases("cek"), "./untyped", "-prelude", "-big-step"))
+	t.Run("ArithmeticCEK", testCases(cases("cek"), "./untyped", "-prelude", "-cek"))
+	t.Run("FreeSmallStep", testCases(cases("free"), "./untyped", "-max-steps=100", "-small-step"))
+	t.Run("FreeBigStep", testCases(cases("free"), "./untyped", "-max-steps=100", "-big-step"))
+	t.Run("FreeCEK", testCases(cases("free"), "./untyped", "-max-steps=100", "-cek"))
+	t.Run("SKI", testCases(cases("ski"), "./untyped", "-prelude", "-max-steps=100000", "-ski"))
+	t.Run("SKIBC", testCases(cases("ski"), "./untyped", "-prelude", "-max-steps=100000", "-ski", "-bc"))
+	t.Run("SKIUnchecked", testCases(cases("ski/unchecked"), "./untyped", "-prelude", "-ski"))
+	t.Run("Lexical", testCases(cases("lexical"), "./untyped", "-small-step"))
+	t.Run("OutputDeBruijn", testCases(override(inOut, "debruijn"), "./untyped", "-output=debruijn", "-small-step"))
+	t.Run("InputDeBruijn", testCases(cases("nameless"), "./untyped", "-input=debruijn", "-small-step"))
+	t.Run("RoundTripDeBruijn", roundTrip(inOut, "debruijn"))
+	t.Run("RoundTripNamed", roundTrip(inOut, "named"))
+	t.Run("RoundTripLexical", roundTrip(cases("lexical"), "named"))
+	t.Run("Timeout", func(t *testing.T) {
+		in := filepath.Join(testPath, "diverge", "2.in.txt")
+		out, err := exec.Command("./untyped", "-timeout=100ms", "-small-step", in).CombinedOutput()
+		if err == nil || !bytes.HasSuffix(out, []byte("evaluation did not terminate within 100ms\n")) {
+			t.Errorf("%v:\n%s", err, out)
+		}
+	})
 }
 
+func benchmark(b *testing.B, args ...string) {
+	goDir := filepath.Join(projectRoot, "go", "untyped")
+	os.Chdir(goDir)
+	if err := run("go", "build"); err != nil {
+		b.Fatal(err)
+	}
+	args = append(args, "-prelude", filepath.Join(testPath, "cek", "1.in.txt"))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if out, err := exec.Command("./untyped", args...).CombinedOutput(); err != nil {
+			b.Fatalf("%v:\n%s", err, out)
+		}
+	}
+}
+
+func BenchmarkBigStep(b *testing.B) { benchmark(b, "-big-step") }
+func BenchmarkCEK(b *testing.B)     { benchmark(b, "-cek") }
+
 func TestSML(t *testing.T) {
 	if _, err := exec.LookPath("mlton"); err != nil {
 		t.Skip("could not find 'mlton' executable in PATH")